@@ -0,0 +1,359 @@
+package gee
+
+import (
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/textproto"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// 将请求中的数据解析到结构体中
+// JSON、XML 使用标准库解码，其余按 struct tag 映射:
+//   form:"name"    表单和 query 参数
+//   header:"name"  请求头
+//   uri:"name"     路由参数 c.Params
+//   time_format:"2006-01-02"  time.Time 的格式，默认 RFC3339，"unix" 表示秒级时间戳
+// 没有 tag 的嵌套结构体会继续按字段映射，tag 为 "-" 的字段会被忽略
+
+// 解析 multipart/form-data 时默认使用的内存上限，超出部分写入临时文件
+const defaultMultipartMemory = 32 << 20 // 32 MB
+
+type Binding interface {
+	Name() string
+	Bind(c *Context, obj interface{}) error
+}
+
+var (
+	JSONBinding   Binding = jsonBinding{}
+	XMLBinding    Binding = xmlBinding{}
+	FormBinding   Binding = formBinding{}
+	QueryBinding  Binding = queryBinding{}
+	HeaderBinding Binding = headerBinding{}
+	URIBinding    Binding = uriBinding{}
+)
+
+type jsonBinding struct{}
+
+func (jsonBinding) Name() string { return "json" }
+
+func (jsonBinding) Bind(c *Context, obj interface{}) error {
+	if c.Req.Body == nil {
+		return errors.New("invalid request: empty body")
+	}
+	return json.NewDecoder(c.Req.Body).Decode(obj)
+}
+
+type xmlBinding struct{}
+
+func (xmlBinding) Name() string { return "xml" }
+
+func (xmlBinding) Bind(c *Context, obj interface{}) error {
+	if c.Req.Body == nil {
+		return errors.New("invalid request: empty body")
+	}
+	return xml.NewDecoder(c.Req.Body).Decode(obj)
+}
+
+// 表单绑定同时包含 query 参数和 body 中的表单字段
+type formBinding struct{}
+
+func (formBinding) Name() string { return "form" }
+
+func (formBinding) Bind(c *Context, obj interface{}) error {
+	if err := c.Req.ParseMultipartForm(c.maxMultipartMemory()); err != nil && err != http.ErrNotMultipart {
+		return err
+	}
+	return mapValues(obj, "form", func(name string) ([]string, bool) {
+		values, ok := c.Req.Form[name]
+		return values, ok
+	})
+}
+
+type queryBinding struct{}
+
+func (queryBinding) Name() string { return "query" }
+
+func (queryBinding) Bind(c *Context, obj interface{}) error {
+	query := c.Req.URL.Query()
+	return mapValues(obj, "form", func(name string) ([]string, bool) {
+		values, ok := query[name]
+		return values, ok
+	})
+}
+
+type headerBinding struct{}
+
+func (headerBinding) Name() string { return "header" }
+
+func (headerBinding) Bind(c *Context, obj interface{}) error {
+	return mapValues(obj, "header", func(name string) ([]string, bool) {
+		values, ok := c.Req.Header[textproto.CanonicalMIMEHeaderKey(name)]
+		return values, ok
+	})
+}
+
+type uriBinding struct{}
+
+func (uriBinding) Name() string { return "uri" }
+
+func (uriBinding) Bind(c *Context, obj interface{}) error {
+	return mapValues(obj, "uri", func(name string) ([]string, bool) {
+		value, ok := c.Params.Get(name)
+		return []string{value}, ok
+	})
+}
+
+// 根据请求方式和 Content-Type 选择 Binding
+func defaultBinding(method string, contentType string) Binding {
+	if method == http.MethodGet || method == http.MethodHead {
+		return FormBinding
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/json":
+		return JSONBinding
+	case "application/xml", "text/xml":
+		return XMLBinding
+	default:
+		return FormBinding
+	}
+}
+
+// 按 tag 将 lookup 返回的值写入 obj 指向的结构体
+func mapValues(obj interface{}, tag string, lookup func(name string) ([]string, bool)) error {
+	v := reflect.ValueOf(obj)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("binding target must be a non-nil struct pointer, got %T", obj)
+	}
+	_, err := mapStruct(v.Elem(), tag, lookup)
+	return err
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// 返回是否有字段被赋值，用于决定是否为嵌套的结构体指针分配内存
+func mapStruct(v reflect.Value, tag string, lookup func(name string) ([]string, bool)) (bool, error) {
+	t := v.Type()
+	set := false
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		// 未导出的字段不能赋值；未导出的嵌入结构体中导出的字段可以赋值，
+		// 但未导出的嵌入指针既不能分配内存，也不能通过它赋值
+		if sf.PkgPath != "" && (!sf.Anonymous || sf.Type.Kind() == reflect.Ptr) {
+			continue
+		}
+		name := sf.Tag.Get(tag)
+		if name == "-" {
+			continue
+		}
+		field := v.Field(i)
+
+		if name == "" {
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && ft != timeType {
+				ok, err := mapNested(field, tag, lookup)
+				if err != nil {
+					return false, err
+				}
+				set = set || ok
+				continue
+			}
+			name = sf.Name
+		}
+
+		values, ok := lookup(name)
+		if !ok || len(values) == 0 {
+			continue
+		}
+		if err := setField(field, sf, values); err != nil {
+			return false, fmt.Errorf("bind field %s: %v", sf.Name, err)
+		}
+		set = true
+	}
+	return set, nil
+}
+
+func mapNested(field reflect.Value, tag string, lookup func(name string) ([]string, bool)) (bool, error) {
+	if field.Kind() != reflect.Ptr {
+		return mapStruct(field, tag, lookup)
+	}
+	elem := field
+	if field.IsNil() {
+		elem = reflect.New(field.Type().Elem())
+	}
+	ok, err := mapStruct(elem.Elem(), tag, lookup)
+	if ok && field.IsNil() {
+		field.Set(elem)
+	}
+	return ok, err
+}
+
+func setField(field reflect.Value, sf reflect.StructField, values []string) error {
+	switch field.Kind() {
+	case reflect.Slice:
+		slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+		for i, s := range values {
+			if err := setValue(slice.Index(i), sf, s); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+		return nil
+	case reflect.Array:
+		if len(values) != field.Len() {
+			return fmt.Errorf("%q is not valid value for %s", values, field.Type())
+		}
+		for i, s := range values {
+			if err := setValue(field.Index(i), sf, s); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return setValue(field, sf, values[0])
+}
+
+// 将字符串 s 转换为 v 的类型并赋值，空字符串保留零值
+func setValue(v reflect.Value, sf reflect.StructField, s string) error {
+	if v.Kind() == reflect.Ptr {
+		elem := reflect.New(v.Type().Elem())
+		if err := setValue(elem.Elem(), sf, s); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	}
+	if v.Type() == timeType {
+		return setTime(v, sf, s)
+	}
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+	if s == "" && v.Kind() != reflect.String {
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == reflect.TypeOf(time.Duration(0)) {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return err
+			}
+			v.SetInt(int64(d))
+			return nil
+		}
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+func setTime(v reflect.Value, sf reflect.StructField, s string) error {
+	if s == "" {
+		return nil
+	}
+	format := sf.Tag.Get("time_format")
+	if format == "" {
+		format = time.RFC3339
+	}
+	if format == "unix" {
+		sec, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(time.Unix(sec, 0)))
+		return nil
+	}
+	t, err := time.Parse(format, s)
+	if err != nil {
+		return err
+	}
+	v.Set(reflect.ValueOf(t))
+	return nil
+}
+
+// 根据请求方式和 Content-Type 选择 Binding 解析请求，出错时只返回 error
+func (c *Context) ShouldBind(obj interface{}) error {
+	return c.ShouldBindWith(obj, defaultBinding(c.Method, c.Req.Header.Get("Content-Type")))
+}
+
+// 使用指定的 Binding 解析请求，解析成功后按 binding tag 校验
+func (c *Context) ShouldBindWith(obj interface{}, b Binding) error {
+	if err := b.Bind(c, obj); err != nil {
+		return err
+	}
+	return c.engine.Validate(obj)
+}
+
+// 与 ShouldBind 相同，出错时通过 AbortWithBindError 返回 400
+func (c *Context) Bind(obj interface{}) error {
+	return c.BindWith(obj, defaultBinding(c.Method, c.Req.Header.Get("Content-Type")))
+}
+
+func (c *Context) BindWith(obj interface{}, b Binding) error {
+	if err := c.ShouldBindWith(obj, b); err != nil {
+		c.AbortWithBindError(err)
+		return err
+	}
+	return nil
+}
+
+func (c *Context) BindJSON(obj interface{}) error {
+	return c.BindWith(obj, JSONBinding)
+}
+
+func (c *Context) BindXML(obj interface{}) error {
+	return c.BindWith(obj, XMLBinding)
+}
+
+func (c *Context) BindForm(obj interface{}) error {
+	return c.BindWith(obj, FormBinding)
+}
+
+func (c *Context) BindQuery(obj interface{}) error {
+	return c.BindWith(obj, QueryBinding)
+}
+
+func (c *Context) BindHeader(obj interface{}) error {
+	return c.BindWith(obj, HeaderBinding)
+}
+
+func (c *Context) BindURI(obj interface{}) error {
+	return c.BindWith(obj, URIBinding)
+}
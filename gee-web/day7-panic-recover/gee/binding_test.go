@@ -0,0 +1,124 @@
+package gee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bindAddress struct {
+	City string `form:"city" json:"city"`
+	Zip  int    `form:"zip" json:"zip"`
+}
+
+type bindUser struct {
+	Name     string        `form:"name" json:"name" xml:"name"`
+	Age      int           `form:"age" json:"age" xml:"age"`
+	Admin    bool          `form:"admin" json:"admin"`
+	Tags     []string      `form:"tag" json:"tags"`
+	Scores   []float64     `form:"score" json:"scores"`
+	Birthday time.Time     `form:"birthday" time_format:"2006-01-02" json:"birthday"`
+	Timeout  time.Duration `form:"timeout" json:"timeout"`
+	Nick     *string       `form:"nick" json:"nick"`
+	Address  bindAddress   `json:"address"`
+	Ignored  string        `form:"-" json:"-"`
+}
+
+func TestBindForm(t *testing.T) {
+	form := url.Values{
+		"name":     {"geektutu"},
+		"age":      {"20"},
+		"admin":    {"true"},
+		"tag":      {"go", "web"},
+		"score":    {"1.5", "2"},
+		"birthday": {"1999-08-17"},
+		"timeout":  {"1m30s"},
+		"nick":     {"tutu"},
+		"city":     {"hangzhou"},
+		"zip":      {"310000"},
+		"Ignored":  {"x"},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	c := &Context{Req: req, Method: req.Method}
+
+	var u bindUser
+	if err := c.ShouldBind(&u); err != nil {
+		t.Fatal(err)
+	}
+	if u.Name != "geektutu" || u.Age != 20 || !u.Admin || len(u.Tags) != 2 || u.Scores[0] != 1.5 ||
+		u.Birthday.Year() != 1999 || u.Timeout != 90*time.Second || *u.Nick != "tutu" ||
+		u.Address.City != "hangzhou" || u.Address.Zip != 310000 || u.Ignored != "" {
+		t.Fatalf("unexpected binding result %+v", u)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/users?age=abc", nil)
+	c = &Context{Req: req, Method: req.Method}
+	if err := c.ShouldBind(&u); err == nil || !strings.Contains(err.Error(), "Age") {
+		t.Fatalf("invalid int should fail with field name, got %v", err)
+	}
+}
+
+type bindBase struct {
+	Name string `form:"name"`
+}
+
+func TestBindUnexportedEmbedded(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/users?name=bob", nil)
+	c := &Context{Req: req, Method: req.Method}
+
+	var v struct{ bindBase }
+	if err := c.BindQuery(&v); err != nil || v.Name != "bob" {
+		t.Fatalf("embedded struct should be bound, got %+v %v", v, err)
+	}
+	// 未导出的嵌入指针被跳过，不能 panic
+	var p struct{ *bindBase }
+	if err := c.BindQuery(&p); err != nil || p.bindBase != nil {
+		t.Fatalf("unexported embedded pointer should be skipped, got %+v %v", p, err)
+	}
+}
+
+func TestBindJSON(t *testing.T) {
+	body := `{"name":"geektutu","age":20,"tags":["go"],"birthday":"1999-08-17T00:00:00Z","address":{"city":"hangzhou"}}`
+	req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	c := &Context{Req: req, Method: req.Method}
+
+	var u bindUser
+	if err := c.ShouldBind(&u); err != nil {
+		t.Fatal(err)
+	}
+	if u.Name != "geektutu" || u.Age != 20 || u.Tags[0] != "go" || u.Address.City != "hangzhou" {
+		t.Fatalf("unexpected binding result %+v", u)
+	}
+}
+
+func TestBindHeaderAndURI(t *testing.T) {
+	var got struct {
+		ID    int64  `uri:"id"`
+		Token string `header:"x-token"`
+		Page  int    `form:"page"`
+	}
+	r := New()
+	r.GET("/users/:id", func(c *Context) {
+		if c.BindURI(&got) != nil || c.BindHeader(&got) != nil || c.BindQuery(&got) != nil {
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/users/42?page=3", nil)
+	req.Header.Set("X-Token", "secret")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || got.ID != 42 || got.Token != "secret" || got.Page != 3 {
+		t.Fatalf("unexpected binding result %d %+v", w.Code, got)
+	}
+
+	w = performRequest(r, http.MethodGet, "/users/abc")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid uri param should be 400, got %d", w.Code)
+	}
+}
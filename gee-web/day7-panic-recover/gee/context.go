@@ -2,41 +2,184 @@ package gee
 
 import "C"
 import (
-	"encoding/json"
+	"context"
 	"fmt"
+	"math"
 	"net/http"
+	"sync"
+	"time"
 )
 
 type H map[string]interface{}
 
+// 调用 Abort 后 index 被设置为 abortIndex，后续的 handler 都不会再执行
+const abortIndex int = math.MaxInt32 >> 1
+
+// Context 由 Engine 通过 sync.Pool 复用，请求处理完毕后不能再使用，
+// 需要在 goroutine 中使用时请调用 Copy
 type Context struct {
 	// origin objects
-	Writer http.ResponseWriter
+	writermem responseWriter	// 随 Context 一起复用，避免每次请求分配
+	Writer ResponseWriter
 	Req *http.Request
 	// request info
 	Path string
 	Method string
-	Params map[string]string	// 访问解析的参数
+	Params Params	// 访问解析的参数
 	// response info
+	// Deprecated: 请使用 c.Writer.Status()。保留以兼容旧代码，
+	// 每次通过 Writer 设置状态码时同步更新，直接修改它不会影响响应
 	StatusCode int
 	// middleware
 	handlers []HandlerFunc
 	index int		// 记录当前执行到第几个中间件
+	redirect string	// 需要重定向到的规范路径，由 router 设置
+	Errors []error	// 处理请求过程中附加的错误，由 AbortWithError 等写入
+	// 请求级别的 key/value 存储，用于在中间件和 handler 之间传递数据
+	Keys map[string]interface{}
+	mu sync.RWMutex	// 保护 Keys
 
 	engine *Engine
 }
 
-func newContext(w http.ResponseWriter, req *http.Request) *Context {
-	return &Context{
-		Writer: w,
-		Req: req,
+// 复用 Context 前重置所有请求相关的字段，Params 保留底层数组
+func (c *Context) reset(w http.ResponseWriter, req *http.Request) {
+	c.writermem.reset(w)
+	c.writermem.statusCode = &c.StatusCode
+	c.Writer = &c.writermem
+	c.Req = req
+	c.Path = req.URL.Path
+	c.Method = req.Method
+	c.Params = c.Params[:0]
+	c.StatusCode = c.writermem.Status()
+	c.handlers = nil
+	c.index = -1
+	c.redirect = ""
+	c.Errors = c.Errors[:0]
+	c.Keys = nil
+}
+
+// 返回一个可以在请求结束后安全使用的副本，例如传给 goroutine。
+// 副本持有独立的 Params，但不能再通过 Writer 写响应，也不能调用 Next
+func (c *Context) Copy() *Context {
+	cp := &Context{
+		writermem:  c.writermem,
+		Req:        c.Req,
+		Path:       c.Path,
+		Method:     c.Method,
+		Params:     make(Params, len(c.Params)),
+		StatusCode: c.StatusCode,
+		index:      abortIndex,
+		Errors:     append([]error(nil), c.Errors...),
+		engine:     c.engine,
+	}
+	// 副本只保留状态码等信息，不能写响应
+	cp.writermem.ResponseWriter = nil
+	cp.writermem.statusCode = &cp.StatusCode
+	cp.Writer = &cp.writermem
+	copy(cp.Params, c.Params)
+	c.mu.RLock()
+	if c.Keys != nil {
+		cp.Keys = make(map[string]interface{}, len(c.Keys))
+		for k, v := range c.Keys {
+			cp.Keys[k] = v
+		}
+	}
+	c.mu.RUnlock()
+	return cp
+}
+
+// 保存一个请求级别的值，可以在 goroutine 中并发调用
+func (c *Context) Set(key string, value interface{}) {
+	c.mu.Lock()
+	if c.Keys == nil {
+		c.Keys = make(map[string]interface{})
+	}
+	c.Keys[key] = value
+	c.mu.Unlock()
+}
+
+// 获取 Set 保存的值，exists 表示 key 是否存在
+func (c *Context) Get(key string) (value interface{}, exists bool) {
+	c.mu.RLock()
+	value, exists = c.Keys[key]
+	c.mu.RUnlock()
+	return
+}
+
+// 与 Get 相同，但 key 不存在时 panic
+func (c *Context) MustGet(key string) interface{} {
+	if value, exists := c.Get(key); exists {
+		return value
+	}
+	panic(fmt.Sprintf("key \"%s\" does not exist", key))
+}
+
+// 以下类型化的 getter 在 key 不存在或类型不匹配时返回零值
+
+func (c *Context) GetString(key string) (s string) {
+	if value, ok := c.Get(key); ok {
+		s, _ = value.(string)
+	}
+	return
+}
+
+func (c *Context) GetBool(key string) (b bool) {
+	if value, ok := c.Get(key); ok {
+		b, _ = value.(bool)
+	}
+	return
+}
+
+func (c *Context) GetInt(key string) (i int) {
+	if value, ok := c.Get(key); ok {
+		i, _ = value.(int)
+	}
+	return
+}
+
+func (c *Context) GetInt64(key string) (i64 int64) {
+	if value, ok := c.Get(key); ok {
+		i64, _ = value.(int64)
+	}
+	return
+}
+
+func (c *Context) GetFloat64(key string) (f64 float64) {
+	if value, ok := c.Get(key); ok {
+		f64, _ = value.(float64)
+	}
+	return
+}
 
-		Path: req.URL.Path,
-		Method: req.Method,
+func (c *Context) GetTime(key string) (t time.Time) {
+	if value, ok := c.Get(key); ok {
+		t, _ = value.(time.Time)
+	}
+	return
+}
 
-		index: -1,
+func (c *Context) GetDuration(key string) (d time.Duration) {
+	if value, ok := c.Get(key); ok {
+		d, _ = value.(time.Duration)
 	}
+	return
 }
+
+func (c *Context) GetStringSlice(key string) (ss []string) {
+	if value, ok := c.Get(key); ok {
+		ss, _ = value.([]string)
+	}
+	return
+}
+
+func (c *Context) GetStringMap(key string) (sm map[string]interface{}) {
+	if value, ok := c.Get(key); ok {
+		sm, _ = value.(map[string]interface{})
+	}
+	return
+}
+
 // 调用 Next方法是，控制权交给了下一个中间件，直到调用到最后一个中间件,
 // 然后再从后往前，调用每个中间件在 Next方法之后定义的部分
 // index是记录当前执行到第几个中间件
@@ -48,18 +191,87 @@ func (c *Context) Next() {
 	}
 }
 
+// 终止处理链，当前 handler 返回后不再执行后续的 handler，
+// 已经执行过的中间件在 Next 之后的部分仍会执行
+func (c *Context) Abort() {
+	c.index = abortIndex
+}
+
+// 是否已经调用过 Abort
+func (c *Context) IsAborted() bool {
+	return c.index >= abortIndex
+}
+
+// 终止处理链并只写入状态码
+func (c *Context) AbortWithStatus(code int) {
+	c.Abort()
+	c.Status(code)
+}
+
+// 终止处理链并返回自定义的 JSON。
+// 之前设置的 Content-Type(如 HTML 渲染失败时的 text/html)会被覆盖
+func (c *Context) AbortWithStatusJSON(code int, obj interface{}) {
+	c.Abort()
+	c.Writer.Header().Del("Content-Type")
+	c.JSON(code, obj)
+}
+
+// 终止处理链，写入状态码并把 err 附加到 c.Errors，由 Logger 等中间件统一处理
+func (c *Context) AbortWithError(code int, err error) {
+	c.AbortWithStatus(code)
+	c.Errors = append(c.Errors, err)
+}
+
 func (c *Context) Fail(code int, err string) {
-	c.index = len(c.handlers)
-	c.JSON(code, H{"message": err})
+	c.AbortWithStatusJSON(code, H{"message": err})
+}
+
+// 以下方法使 *Context 实现 context.Context，可以直接传给数据库、RPC 等接口，
+// 截止时间和取消信号来自 c.Req.Context()，Value 先查找请求的 context，再查找 Keys
+
+var _ context.Context = &Context{}
+
+func (c *Context) Deadline() (deadline time.Time, ok bool) {
+	if c.Req == nil {
+		return
+	}
+	return c.Req.Context().Deadline()
+}
+
+func (c *Context) Done() <-chan struct{} {
+	if c.Req == nil {
+		return nil
+	}
+	return c.Req.Context().Done()
+}
+
+func (c *Context) Err() error {
+	if c.Req == nil {
+		return nil
+	}
+	return c.Req.Context().Err()
+}
+
+func (c *Context) Value(key interface{}) interface{} {
+	if c.Req != nil {
+		if value := c.Req.Context().Value(key); value != nil {
+			return value
+		}
+	}
+	if k, ok := key.(string); ok {
+		if value, exists := c.Get(k); exists {
+			return value
+		}
+	}
+	return nil
 }
 
 func (c *Context) Param(key string) string {
-	value, _ := c.Params[key]
-	return value
+	return c.Params.ByName(key)
 }
 
+// 设置状态码，响应头在第一次写入 body 或请求结束时发送
 func (c *Context) Status(code int) {
-	c.StatusCode = code
 	c.Writer.WriteHeader(code)
 }
 
@@ -76,29 +288,17 @@ func (c *Context) Query(key string) string {
 }
 
 func (c *Context) String(code int, format string, values ...interface{}) {
-	c.SetHeader("Content-Type", "text/plain")
-	c.Status(code)
-	c.Writer.Write([]byte(fmt.Sprintf(format, values...)))
+	c.Render(code, String{Format: format, Data: values})
 }
 
 func (c *Context) JSON(code int, obj interface{}) {
-	c.SetHeader("Content-Type", "application/json")
-	c.Status(code)
-	encoder := json.NewEncoder(c.Writer)
-	if err := encoder.Encode(obj); err != nil {
-		http.Error(c.Writer, err.Error(), 500)
-	}
+	c.Render(code, JSON{Data: obj})
 }
 
 func (c *Context) Data(code int, data []byte) {
-	c.Status(code)
-	c.Writer.Write(data)
+	c.Render(code, DataRender{Data: data})
 }
-// 支持根据模板文件名选择模进行渲染
+// 支持根据模板文件名选择模进行渲染，模板执行失败时返回 500，错误信息只写入日志
 func (c *Context) HTML(code int, name string, data interface{}) {
-	c.SetHeader("Content-Type", "text/html")
-	c.Status(code)
-	if err := c.engine.htmlTemplates.ExecuteTemplate(c.Writer, name, data); err != nil {
-		c.Fail(500, err.Error())
-	}
+	c.Render(code, HTMLRender{Template: c.engine.htmlTemplates, Name: name, Data: data})
 }
\ No newline at end of file
@@ -0,0 +1,170 @@
+package gee
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestContextCopy(t *testing.T) {
+	r := New()
+	var copied []*Context
+	r.GET("/hello/:name", func(c *Context) {
+		copied = append(copied, c.Copy())
+	})
+	performRequest(r, http.MethodGet, "/hello/geektutu")
+	// Context 被复用后，副本中的参数不受影响
+	performRequest(r, http.MethodGet, "/hello/jack")
+
+	cp := copied[0]
+	if cp.Param("name") != "geektutu" || cp.Path != "/hello/geektutu" {
+		t.Fatalf("copy should keep its own params, got %v %s", cp.Params, cp.Path)
+	}
+}
+
+func TestContextReset(t *testing.T) {
+	r := New()
+	r.GET("/hello/:name", func(c *Context) {
+		c.String(http.StatusOK, "%s %d", c.Param("name"), len(c.Params))
+	})
+	for _, name := range []string{"geektutu", "jack", "tom"} {
+		w := performRequest(r, http.MethodGet, "/hello/"+name)
+		if w.Body.String() != name+" 1" {
+			t.Fatalf("unexpected body %q", w.Body.String())
+		}
+	}
+}
+
+// 一个中间件 + 带参数路由的典型请求
+func BenchmarkServeHTTP(b *testing.B) {
+	r := New()
+	r.Use(func(c *Context) {
+		c.Next()
+	})
+	v1 := r.Group("/v1")
+	v1.Use(func(c *Context) {
+		c.Next()
+	})
+	v1.GET("/users/:id/comments/:cid", func(c *Context) {
+		_ = c.Param("id") + c.Param("cid")
+	})
+	req := httptest.NewRequest(http.MethodGet, "/v1/users/42/comments/7", nil)
+	w := httptest.NewRecorder()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.ServeHTTP(w, req)
+	}
+}
+
+func TestAbort(t *testing.T) {
+	r := New()
+	var aborted bool
+	var order []string
+	r.Use(func(c *Context) {
+		c.Next()
+		aborted = c.IsAborted()
+	})
+	auth := func(c *Context) {
+		order = append(order, "auth")
+		if c.Query("token") == "" {
+			c.AbortWithError(http.StatusUnauthorized, errors.New("missing token"))
+			return
+		}
+		c.Next()
+	}
+	r.GET("/secret", auth, func(c *Context) {
+		order = append(order, "handler")
+		c.String(http.StatusOK, "ok")
+	})
+	r.GET("/json", func(c *Context) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, H{"code": 40100})
+	}, func(c *Context) {
+		order = append(order, "unreachable")
+	})
+
+	w := performRequest(r, http.MethodGet, "/secret")
+	if w.Code != http.StatusUnauthorized || !aborted || fmt.Sprint(order) != "[auth]" {
+		t.Fatalf("unexpected abort result %d %t %v", w.Code, aborted, order)
+	}
+
+	order = nil
+	w = performRequest(r, http.MethodGet, "/secret?token=1")
+	if w.Code != http.StatusOK || aborted || fmt.Sprint(order) != "[auth handler]" {
+		t.Fatalf("unexpected result %d %t %v", w.Code, aborted, order)
+	}
+
+	order = nil
+	w = performRequest(r, http.MethodGet, "/json")
+	if w.Code != http.StatusUnauthorized || w.Body.String() != "{\"code\":40100}\n" || len(order) != 0 {
+		t.Fatalf("unexpected result %d %s %v", w.Code, w.Body.String(), order)
+	}
+}
+
+func TestContextKeys(t *testing.T) {
+	r := New()
+	now := time.Now()
+	r.Use(func(c *Context) {
+		c.Set("user", "geektutu")
+		c.Set("tenant", 42)
+		c.Set("login", now)
+		c.Next()
+	})
+	r.GET("/profile", func(c *Context) {
+		if c.GetString("user") != "geektutu" || c.GetInt("tenant") != 42 || !c.GetTime("login").Equal(now) {
+			t.Errorf("unexpected keys %v", c.Keys)
+		}
+		// 类型不匹配时返回零值
+		if c.GetString("tenant") != "" || c.GetInt("missing") != 0 {
+			t.Errorf("mismatched getter should return zero value")
+		}
+		if c.MustGet("user") != "geektutu" {
+			t.Errorf("MustGet failed")
+		}
+	})
+	r.GET("/empty", func(c *Context) {
+		if _, ok := c.Get("user"); !ok {
+			t.Errorf("key set by middleware should exist")
+		}
+		c.Set("request", "1")
+	})
+	performRequest(r, http.MethodGet, "/profile")
+	// 复用的 Context 不会残留上一个请求的值
+	r.GET("/fresh", func(c *Context) {
+		if _, ok := c.Get("request"); ok {
+			t.Errorf("keys should be reset between requests")
+		}
+	})
+	performRequest(r, http.MethodGet, "/empty")
+	performRequest(r, http.MethodGet, "/fresh")
+}
+
+type ctxKey string
+
+func TestContextAsContext(t *testing.T) {
+	r := New()
+	r.GET("/query", func(c *Context) {
+		c.Set("tenant", "gee")
+		query := func(ctx context.Context) {
+			if _, ok := ctx.Deadline(); !ok {
+				t.Errorf("deadline of request context should be visible")
+			}
+			if ctx.Value("tenant") != "gee" || ctx.Value(ctxKey("trace")) != "abc" {
+				t.Errorf("unexpected values %v %v", ctx.Value("tenant"), ctx.Value(ctxKey("trace")))
+			}
+			if ctx.Err() != nil {
+				t.Errorf("request context should not be done")
+			}
+		}
+		query(c)
+	})
+
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), ctxKey("trace"), "abc"), time.Minute)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodGet, "/query", nil).WithContext(ctx)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+}
@@ -0,0 +1,178 @@
+package gee
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// cookie 的读写
+// 签名 cookie:  base64(value).base64(HMAC-SHA256(name=value))，内容可见但不能被篡改
+// 加密 cookie:  base64(nonce + AES-256-GCM(value))，cookie 名作为附加数据，内容不可见也不能被篡改
+// 密钥取自 Engine.CookieKeys，签名和加密分别使用由密钥派生出的子密钥，
+// 因此同一个密钥可以同时用于两种 cookie，长度也不受 AES 的限制
+
+var (
+	ErrNoCookieKeys  = errors.New("gee: Engine.CookieKeys is empty")
+	ErrInvalidCookie = errors.New("gee: invalid cookie")
+)
+
+// 由密钥派生用于不同用途的子密钥
+func deriveKey(key []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+func (c *Context) cookieKeys() ([][]byte, error) {
+	if c.engine == nil || len(c.engine.CookieKeys) == 0 {
+		return nil, ErrNoCookieKeys
+	}
+	return c.engine.CookieKeys, nil
+}
+
+// 设置 cookie，value 会被 URL 编码，Path 为空时默认为 /
+// eg, c.SetCookie(&http.Cookie{Name: "lang", Value: "zh-CN", MaxAge: 3600, HttpOnly: true})
+func (c *Context) SetCookie(cookie *http.Cookie) {
+	cp := *cookie
+	if cp.Path == "" {
+		cp.Path = "/"
+	}
+	cp.Value = url.QueryEscape(cp.Value)
+	http.SetCookie(c.Writer, &cp)
+}
+
+// 返回 URL 解码后的 cookie 值，不存在时返回 http.ErrNoCookie
+func (c *Context) Cookie(name string) (string, error) {
+	cookie, err := c.Req.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	return url.QueryUnescape(cookie.Value)
+}
+
+func signCookie(key []byte, name string, value string) []byte {
+	mac := hmac.New(sha256.New, deriveKey(key, "gee-cookie-signing"))
+	mac.Write([]byte(name + "=" + value))
+	return mac.Sum(nil)
+}
+
+// 设置带 HMAC 签名的 cookie
+func (c *Context) SetSignedCookie(cookie *http.Cookie) error {
+	keys, err := c.cookieKeys()
+	if err != nil {
+		return err
+	}
+	cp := *cookie
+	sig := signCookie(keys[0], cp.Name, cp.Value)
+	cp.Value = base64.RawURLEncoding.EncodeToString([]byte(cp.Value)) + "." +
+		base64.RawURLEncoding.EncodeToString(sig)
+	c.SetCookie(&cp)
+	return nil
+}
+
+// 校验签名并返回原始值，签名不匹配时返回 ErrInvalidCookie
+func (c *Context) SignedCookie(name string) (string, error) {
+	keys, err := c.cookieKeys()
+	if err != nil {
+		return "", err
+	}
+	raw, err := c.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	i := strings.IndexByte(raw, '.')
+	if i < 0 {
+		return "", ErrInvalidCookie
+	}
+	value, err1 := base64.RawURLEncoding.DecodeString(raw[:i])
+	sig, err2 := base64.RawURLEncoding.DecodeString(raw[i+1:])
+	if err1 != nil || err2 != nil {
+		return "", ErrInvalidCookie
+	}
+	for _, key := range keys {
+		if hmac.Equal(sig, signCookie(key, name, string(value))) {
+			return string(value), nil
+		}
+	}
+	return "", ErrInvalidCookie
+}
+
+func newCookieAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(deriveKey(key, "gee-cookie-encryption"))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// 用 keys[0] 加密 value，name 作为附加数据，防止密文被挪到其他 cookie 中使用
+func encryptCookie(keys [][]byte, name string, value []byte) (string, error) {
+	aead, err := newCookieAEAD(keys[0])
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, value, []byte(name))), nil
+}
+
+// 依次尝试每个密钥解密，全部失败时返回 ErrInvalidCookie
+func decryptCookie(keys [][]byte, name string, raw string) ([]byte, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, ErrInvalidCookie
+	}
+	for _, key := range keys {
+		aead, err := newCookieAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		if len(sealed) < aead.NonceSize() {
+			return nil, ErrInvalidCookie
+		}
+		nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+		if value, err := aead.Open(nil, nonce, ciphertext, []byte(name)); err == nil {
+			return value, nil
+		}
+	}
+	return nil, ErrInvalidCookie
+}
+
+// 设置 AES-GCM 加密的 cookie
+func (c *Context) SetSecureCookie(cookie *http.Cookie) error {
+	keys, err := c.cookieKeys()
+	if err != nil {
+		return err
+	}
+	cp := *cookie
+	if cp.Value, err = encryptCookie(keys, cp.Name, []byte(cp.Value)); err != nil {
+		return err
+	}
+	c.SetCookie(&cp)
+	return nil
+}
+
+// 解密 SetSecureCookie 设置的 cookie，解密失败时返回 ErrInvalidCookie
+func (c *Context) SecureCookie(name string) (string, error) {
+	keys, err := c.cookieKeys()
+	if err != nil {
+		return "", err
+	}
+	raw, err := c.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	value, err := decryptCookie(keys, name, raw)
+	return string(value), err
+}
@@ -0,0 +1,84 @@
+package gee
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCookie(t *testing.T) {
+	r := New()
+	r.GET("/set", func(c *Context) {
+		c.SetCookie(&http.Cookie{Name: "greeting", Value: "hello world; gee", HttpOnly: true})
+	})
+	r.GET("/get", func(c *Context) {
+		value, err := c.Cookie("greeting")
+		if err != nil {
+			c.String(http.StatusNotFound, err.Error())
+			return
+		}
+		c.String(http.StatusOK, value)
+	})
+
+	cookies := performRequest(r, http.MethodGet, "/set").Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Path != "/" || !cookies[0].HttpOnly {
+		t.Fatalf("unexpected cookies %v", cookies)
+	}
+	if w := performRequestWith(r, http.MethodGet, "/get", nil, nil, cookies); w.Body.String() != "hello world; gee" {
+		t.Fatalf("unexpected cookie value %q", w.Body.String())
+	}
+	if w := performRequest(r, http.MethodGet, "/get"); w.Code != http.StatusNotFound {
+		t.Fatalf("missing cookie should return error, got %d", w.Code)
+	}
+}
+
+func TestSignedAndSecureCookie(t *testing.T) {
+	r := New()
+	r.CookieKeys = [][]byte{[]byte("old-secret")}
+	r.GET("/set", func(c *Context) {
+		if err := c.SetSignedCookie(&http.Cookie{Name: "user", Value: "geektutu"}); err != nil {
+			t.Errorf("set signed cookie: %v", err)
+		}
+		if err := c.SetSecureCookie(&http.Cookie{Name: "token", Value: "s3cr3t"}); err != nil {
+			t.Errorf("set secure cookie: %v", err)
+		}
+	})
+	r.GET("/get", func(c *Context) {
+		user, err1 := c.SignedCookie("user")
+		token, err2 := c.SecureCookie("token")
+		if err1 != nil || err2 != nil {
+			c.String(http.StatusUnauthorized, "%v %v", err1, err2)
+			return
+		}
+		c.String(http.StatusOK, user+" "+token)
+	})
+
+	cookies := performRequest(r, http.MethodGet, "/set").Result().Cookies()
+	for _, cookie := range cookies {
+		if cookie.Name == "token" && cookie.Value == "s3cr3t" {
+			t.Fatalf("secure cookie should be encrypted")
+		}
+	}
+	// 轮换密钥后，旧密钥生成的 cookie 仍然有效
+	r.CookieKeys = [][]byte{[]byte("new-secret"), []byte("old-secret")}
+	if w := performRequestWith(r, http.MethodGet, "/get", nil, nil, cookies); w.Body.String() != "geektutu s3cr3t" {
+		t.Fatalf("unexpected result %d %q", w.Code, w.Body.String())
+	}
+
+	// 篡改或密钥被移除后校验失败
+	tampered := []*http.Cookie{{Name: "user", Value: "admin" + cookies[0].Value[8:]}, cookies[1]}
+	if w := performRequestWith(r, http.MethodGet, "/get", nil, nil, tampered); w.Code != http.StatusUnauthorized {
+		t.Fatalf("tampered cookie should be rejected, got %q", w.Body.String())
+	}
+	r.CookieKeys = [][]byte{[]byte("new-secret")}
+	if w := performRequestWith(r, http.MethodGet, "/get", nil, nil, cookies); w.Code != http.StatusUnauthorized {
+		t.Fatalf("cookie signed by a removed key should be rejected, got %q", w.Body.String())
+	}
+	// 签名绑定了 cookie 名，同样的值换一个名字无法通过校验
+	r.CookieKeys = [][]byte{[]byte("old-secret")}
+	r.GET("/role", func(c *Context) {
+		if _, err := c.SignedCookie("role"); err != ErrInvalidCookie {
+			t.Errorf("cookie moved to another name should be rejected, got %v", err)
+		}
+	})
+	performRequestWith(r, http.MethodGet, "/role", nil, nil, []*http.Cookie{{Name: "role", Value: cookies[0].Value}})
+}
@@ -0,0 +1,256 @@
+package gee
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// CSRF 防护，为每个会话生成一个随机的 secret:
+// 在 CSRF 之前注册了 Sessions 中间件时保存在会话中(synchronizer token)，
+// 否则保存在 cookie 中(double-submit cookie)，
+// 配置了 Engine.CookieKeys 时 cookie 会被签名。
+// 表单通过模板函数 csrfField 提交 token，AJAX 通过请求头提交 token，
+// 除 GET、HEAD、OPTIONS、TRACE 以外的请求 token 与 secret 不匹配时返回 403:
+//
+//	r.Use(gee.CSRF(gee.CSRFOptions{}))
+//	r.GET("/form", func(c *gee.Context) {
+//		c.HTML(http.StatusOK, "form.tmpl", gee.H{"ctx": c})
+//	})
+//	// form.tmpl: <form method="post">{{ csrfField .ctx }} ...</form>
+//
+// 每次生成的 token 都用随机数掩码，页面中的 token 每次不同，防止 BREACH 攻击。
+//
+// double-submit cookie 只能证明请求来自能读写该 cookie 的页面:
+// 控制了子域名的攻击者可以写入自己的 cookie (cookie tossing)，再用与之匹配的 token 伪造请求。
+// 不使用 Sessions 时应设置 CSRFOptions.Identity，把 secret 与当前用户绑定
+
+const (
+	csrfSecretLength  = 32
+	csrfContextKey    = "gee/csrf"
+	csrfSessionKey    = "_csrf"
+	defaultCSRFCookie = "_csrf"
+	defaultCSRFField  = "_csrf"
+	defaultCSRFHeader = "X-CSRF-Token"
+)
+
+var ErrInvalidCSRFToken = errors.New("gee: invalid csrf token")
+
+type CSRFOptions struct {
+	// 保存 secret 的 cookie 名，默认 _csrf，使用 Sessions 中间件时不使用
+	CookieName string
+	// 表单中 token 的字段名，默认 _csrf
+	FieldName string
+	// AJAX 请求提交 token 的请求头，默认 X-CSRF-Token
+	HeaderName string
+	// 不检查 token 的路径，以 * 结尾时匹配前缀，eg, /webhooks/*
+	ExemptPaths []string
+	// token 不匹配时的处理函数，默认返回 403
+	ErrorHandler HandlerFunc
+	// cookie 是否只通过 HTTPS 发送
+	Secure bool
+	// 返回当前用户的标识(如登录后的用户 id)，需要在认证中间件之后使用 CSRF。
+	// 不使用 Sessions 时，token 由 cookie 中的 secret 和该标识经 Engine.CookieKeys 的 HMAC 得到，
+	// 攻击者写入的 cookie 对应的 token 不能用于其他用户；
+	// 未设置时 cookie 与用户无关，不能防御来自子域名的 cookie tossing。
+	// 没有配置 Engine.CookieKeys 时请求会 panic
+	Identity func(c *Context) string
+}
+
+// secret 在第一次生成或校验 token 时才读取，不存在时生成并保存，
+// 没有使用 token 的请求(如匿名用户浏览页面)不会创建会话或 cookie
+type csrfState struct {
+	c       *Context
+	options *CSRFOptions
+	keys    [][]byte // 绑定用户标识使用的密钥，为空时不绑定
+	secrets [][]byte // 校验 token 时接受的 secret，第一个用于生成 token，其余为旧密钥对应的 secret
+}
+
+func (s *csrfState) load() [][]byte {
+	if s.secrets != nil {
+		return s.secrets
+	}
+	secret, err := loadCSRFSecret(s.c, s.options)
+	if err != nil {
+		s.c.Errors = append(s.c.Errors, err)
+	}
+	s.secrets = [][]byte{secret}
+	if s.keys != nil {
+		s.secrets = bindCSRFSecret(s.keys, secret, s.options.Identity(s.c))
+	}
+	return s.secrets
+}
+
+func CSRF(options CSRFOptions) HandlerFunc {
+	if options.CookieName == "" {
+		options.CookieName = defaultCSRFCookie
+	}
+	if options.FieldName == "" {
+		options.FieldName = defaultCSRFField
+	}
+	if options.HeaderName == "" {
+		options.HeaderName = defaultCSRFHeader
+	}
+	return func(c *Context) {
+		state := &csrfState{c: c, options: &options}
+		if _, ok := c.Get(sessionContextKey); !ok && options.Identity != nil {
+			keys, err := c.cookieKeys()
+			if err != nil {
+				panic("gee: CSRFOptions.Identity requires Engine.CookieKeys")
+			}
+			state.keys = keys
+		}
+		c.Set(csrfContextKey, state)
+
+		switch c.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			c.Next()
+			return
+		}
+		if options.exempt(c.Path) {
+			c.Next()
+			return
+		}
+		token := c.Req.Header.Get(options.HeaderName)
+		if token == "" {
+			token = c.PostForm(options.FieldName)
+		}
+		if !validCSRFToken(token, state.load()) {
+			c.Errors = append(c.Errors, ErrInvalidCSRFToken)
+			if options.ErrorHandler != nil {
+				c.Abort()
+				options.ErrorHandler(c)
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusForbidden, H{"message": ErrInvalidCSRFToken.Error()})
+			return
+		}
+		c.Next()
+	}
+}
+
+func (options *CSRFOptions) exempt(path string) bool {
+	for _, p := range options.ExemptPaths {
+		if p == path || (strings.HasSuffix(p, "*") && strings.HasPrefix(path, p[:len(p)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+// 读取 secret，不存在或无效时生成新的 secret 并保存
+func loadCSRFSecret(c *Context, options *CSRFOptions) ([]byte, error) {
+	if value, ok := c.Get(sessionContextKey); ok {
+		s := value.(*SessionData)
+		if secret, ok := s.Get(csrfSessionKey).([]byte); ok && len(secret) == csrfSecretLength {
+			return secret, nil
+		}
+		secret := newCSRFSecret()
+		s.Set(csrfSessionKey, secret)
+		return secret, s.Save()
+	}
+
+	var raw string
+	var err error
+	if len(c.engine.CookieKeys) > 0 {
+		raw, err = c.SignedCookie(options.CookieName)
+	} else {
+		raw, err = c.Cookie(options.CookieName)
+	}
+	if err == nil {
+		if secret, err := base64.RawURLEncoding.DecodeString(raw); err == nil && len(secret) == csrfSecretLength {
+			return secret, nil
+		}
+	}
+	secret := newCSRFSecret()
+	cookie := &http.Cookie{
+		Name:     options.CookieName,
+		Value:    base64.RawURLEncoding.EncodeToString(secret),
+		Secure:   options.Secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if len(c.engine.CookieKeys) > 0 {
+		return secret, c.SetSignedCookie(cookie)
+	}
+	c.SetCookie(cookie)
+	return secret, nil
+}
+
+// 用每个 CookieKeys 计算 HMAC(secret + 用户标识)，第一个用于生成 token
+func bindCSRFSecret(keys [][]byte, secret []byte, identity string) [][]byte {
+	secrets := make([][]byte, len(keys))
+	for i, key := range keys {
+		mac := hmac.New(sha256.New, deriveKey(key, "gee-csrf"))
+		mac.Write(secret)
+		mac.Write([]byte(identity))
+		secrets[i] = mac.Sum(nil)
+	}
+	return secrets
+}
+
+func newCSRFSecret() []byte {
+	secret := make([]byte, csrfSecretLength)
+	if _, err := io.ReadFull(rand.Reader, secret); err != nil {
+		panic(err)
+	}
+	return secret
+}
+
+// token 为 base64(otp + (otp XOR secret))
+func maskCSRFSecret(secret []byte) string {
+	token := make([]byte, 2*len(secret))
+	otp := token[:len(secret)]
+	if _, err := io.ReadFull(rand.Reader, otp); err != nil {
+		panic(err)
+	}
+	for i := range secret {
+		token[len(secret)+i] = otp[i] ^ secret[i]
+	}
+	return base64.RawURLEncoding.EncodeToString(token)
+}
+
+func validCSRFToken(token string, secrets [][]byte) bool {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(data) != 2*csrfSecretLength {
+		return false
+	}
+	unmasked := make([]byte, csrfSecretLength)
+	for i := range unmasked {
+		unmasked[i] = data[i] ^ data[csrfSecretLength+i]
+	}
+	for _, secret := range secrets {
+		if subtle.ConstantTimeCompare(unmasked, secret) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func csrfStateOf(c *Context) *csrfState {
+	value, ok := c.Get(csrfContextKey)
+	if !ok {
+		panic("gee: CSRF middleware is not installed")
+	}
+	return value.(*csrfState)
+}
+
+// 当前请求的 token，用于 AJAX 请求头或自定义表单
+func CSRFToken(c *Context) string {
+	return maskCSRFSecret(csrfStateOf(c).load()[0])
+}
+
+// 模板函数 csrfField，生成包含 token 的隐藏表单字段
+func csrfField(c *Context) template.HTML {
+	state := csrfStateOf(c)
+	return template.HTML(fmt.Sprintf(`<input type="hidden" name="%s" value="%s">`,
+		template.HTMLEscapeString(state.options.FieldName), maskCSRFSecret(state.load()[0])))
+}
@@ -0,0 +1,155 @@
+package gee
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestCSRF(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gee-csrf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "form.tmpl"), []byte(`<form method="post">{{ csrfField .ctx }}</form>`), 0644)
+
+	r := New()
+	r.LoadHTMLGlob(filepath.Join(dir, "*"))
+	r.Use(CSRF(CSRFOptions{ExemptPaths: []string{"/webhooks/*"}}))
+	r.GET("/form", func(c *Context) {
+		c.HTML(http.StatusOK, "form.tmpl", H{"ctx": c})
+	})
+	r.GET("/", func(c *Context) {
+		c.String(http.StatusOK, "index")
+	})
+	r.GET("/token", func(c *Context) {
+		c.String(http.StatusOK, CSRFToken(c))
+	})
+	r.POST("/form", func(c *Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	r.POST("/webhooks/github", func(c *Context) {
+		c.String(http.StatusOK, "ok")
+	})
+
+	if cookies := performRequest(r, http.MethodGet, "/").Result().Cookies(); len(cookies) != 0 {
+		t.Fatalf("page without token should not set the cookie, got %v", cookies)
+	}
+	w := performRequest(r, http.MethodGet, "/form")
+	match := regexp.MustCompile(`<input type="hidden" name="_csrf" value="([\w-]+)">`).FindStringSubmatch(w.Body.String())
+	if match == nil {
+		t.Fatalf("csrfField should render a hidden input, got %q", w.Body.String())
+	}
+	cookies := w.Result().Cookies()
+	formHeader := http.Header{"Content-Type": {"application/x-www-form-urlencoded"}}
+
+	if w := performRequestWith(r, http.MethodPost, "/form", nil, nil, cookies); w.Code != http.StatusForbidden {
+		t.Fatalf("post without token should be 403, got %d", w.Code)
+	}
+	if w := performRequestWith(r, http.MethodPost, "/form", strings.NewReader(url.Values{"_csrf": {match[1]}}.Encode()), formHeader, cookies); w.Code != http.StatusOK {
+		t.Fatalf("post with form token should pass, got %d", w.Code)
+	}
+	// AJAX 通过请求头提交，每次生成的 token 不同但都有效
+	token := performRequestWith(r, http.MethodGet, "/token", nil, nil, cookies).Body.String()
+	if token == match[1] {
+		t.Fatalf("token should be masked differently each time")
+	}
+	if w := performRequestWith(r, http.MethodPost, "/form", nil, http.Header{"X-Csrf-Token": {token}}, cookies); w.Code != http.StatusOK {
+		t.Fatalf("post with header token should pass, got %d", w.Code)
+	}
+	// 其他会话的 token 无效
+	other := performRequest(r, http.MethodGet, "/token").Body.String()
+	if w := performRequestWith(r, http.MethodPost, "/form", strings.NewReader(url.Values{"_csrf": {other}}.Encode()), formHeader, cookies); w.Code != http.StatusForbidden {
+		t.Fatalf("token of another session should be 403, got %d", w.Code)
+	}
+	if w := performRequestWith(r, http.MethodPost, "/webhooks/github", nil, nil, nil); w.Code != http.StatusOK {
+		t.Fatalf("exempt path should pass, got %d", w.Code)
+	}
+}
+
+func TestCSRFWithSession(t *testing.T) {
+	r := New()
+	r.CookieKeys = [][]byte{[]byte("secret")}
+	r.Use(Sessions("gee_session", NewMemoryStore(), SessionOptions{}))
+	r.Use(CSRF(CSRFOptions{HeaderName: "X-XSRF-Token"}))
+	r.GET("/token", func(c *Context) {
+		c.String(http.StatusOK, CSRFToken(c))
+	})
+	r.GET("/page", func(c *Context) {
+		c.String(http.StatusOK, "page")
+	})
+	r.DELETE("/items/:id", func(c *Context) {
+		c.String(http.StatusOK, "deleted")
+	})
+
+	// 没有使用 token 的页面不创建会话
+	if cookies := performRequest(r, http.MethodGet, "/page").Result().Cookies(); len(cookies) != 0 {
+		t.Fatalf("page without token should not save the session, got %v", cookies)
+	}
+	w := performRequest(r, http.MethodGet, "/token")
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "gee_session" {
+		t.Fatalf("secret should be kept in the session, got %v", cookies)
+	}
+	header := http.Header{"X-Xsrf-Token": {w.Body.String()}}
+	if w := performRequestWith(r, http.MethodDelete, "/items/1", nil, header, cookies); w.Code != http.StatusOK {
+		t.Fatalf("delete with token should pass, got %d", w.Code)
+	}
+	if w := performRequestWith(r, http.MethodDelete, "/items/1", nil, header, nil); w.Code != http.StatusForbidden {
+		t.Fatalf("token without session should be 403, got %d", w.Code)
+	}
+}
+
+func TestCSRFIdentity(t *testing.T) {
+	r := New()
+	r.CookieKeys = [][]byte{[]byte("secret")}
+	r.Use(CSRF(CSRFOptions{Identity: func(c *Context) string {
+		return c.Req.Header.Get("X-User")
+	}}))
+	r.GET("/token", func(c *Context) {
+		c.String(http.StatusOK, CSRFToken(c))
+	})
+	r.POST("/transfer", func(c *Context) {
+		c.String(http.StatusOK, "ok")
+	})
+
+	// 攻击者取得自己的 cookie 和 token，再通过子域名把 cookie 写入受害者的浏览器
+	w := performRequestWith(r, http.MethodGet, "/token", nil, http.Header{"X-User": {"mallory"}}, nil)
+	cookies := w.Result().Cookies()
+	token := w.Body.String()
+	header := http.Header{"X-User": {"mallory"}, "X-Csrf-Token": {token}}
+	if w := performRequestWith(r, http.MethodPost, "/transfer", nil, header, cookies); w.Code != http.StatusOK {
+		t.Fatalf("token of the same user should pass, got %d", w.Code)
+	}
+	header = http.Header{"X-User": {"alice"}, "X-Csrf-Token": {token}}
+	if w := performRequestWith(r, http.MethodPost, "/transfer", nil, header, cookies); w.Code != http.StatusForbidden {
+		t.Fatalf("tossed cookie should not work for another user, got %d", w.Code)
+	}
+
+	// 换用新密钥后，旧密钥生成的 token 仍然有效
+	r.CookieKeys = [][]byte{[]byte("new secret"), []byte("secret")}
+	header = http.Header{"X-User": {"mallory"}, "X-Csrf-Token": {token}}
+	if w := performRequestWith(r, http.MethodPost, "/transfer", nil, header, cookies); w.Code != http.StatusOK {
+		t.Fatalf("token signed by an old key should pass, got %d", w.Code)
+	}
+}
+
+func TestCSRFIdentityWithoutKeys(t *testing.T) {
+	r := New()
+	r.Use(CSRF(CSRFOptions{Identity: func(c *Context) string { return "alice" }}))
+	r.GET("/token", func(c *Context) {
+		c.String(http.StatusOK, CSRFToken(c))
+	})
+	defer func() {
+		if err := recover(); err != "gee: CSRFOptions.Identity requires Engine.CookieKeys" {
+			t.Fatalf("missing CookieKeys should panic, got %v", err)
+		}
+	}()
+	performRequest(r, http.MethodGet, "/token")
+}
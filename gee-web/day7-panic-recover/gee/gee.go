@@ -1,11 +1,13 @@
 package gee
 
 import (
+	"fmt"
 	"html/template"
 	"log"
 	"net/http"
 	"path"
-	"strings"
+	"reflect"
+	"sync"
 )
 
 // 相当于 handlerFunc(w http.ResponseWriter, req *http.Request)
@@ -24,17 +26,73 @@ type (
 	Engine struct {
 		*RouterGroup
 		router *router
-		groups []*RouterGroup	// store all groups
 		// 模板渲染直接使用 html/template 提供的能力
 		htmlTemplates *template.Template	// for html render	将所有的模板加载进内存
 		funcMap template.FuncMap			// for html render	所有的自定义模板渲染函数
+		namedRoutes map[string]string		// 路由名 => 完整路由，用于反向生成 URL
+		pool sync.Pool						// 复用 Context，减少每个请求的内存分配
+		validators map[string]ValidatorFunc	// 自定义校验规则
+		validations map[reflect.Type][]fieldValidation	// 每种类型解析后的 binding tag
+		validationMu sync.RWMutex
+		noRoute  []HandlerFunc				// 路由不存在时的处理函数
+		noMethod []HandlerFunc				// 路由存在但请求方式不匹配时的处理函数
+		// 未匹配请求的完整处理链(全局中间件 + 处理函数)，在 Use、NoRoute、NoMethod 时重新生成
+		allNoRoute  []HandlerFunc
+		allNoMethod []HandlerFunc
+		allRedirect []HandlerFunc
+		routeChains []routeChain			// 已注册的路由，分组添加中间件后重新生成处理链
+
+		// 路径不匹配、但去掉或补上末尾的 / 后能匹配时，重定向到能匹配的路径，默认开启
+		// eg, /hello/ => /hello，/users => /users/
+		RedirectTrailingSlash bool
+		// 路径不匹配时，先清理路径(去掉多余的 /、解析 . 和 ..)，再忽略大小写查找，
+		// 找到后重定向到修正后的路径，默认关闭
+		// eg, /A/../HELLO => /hello
+		RedirectFixedPath bool
+		// 查找路由前合并连续的 /，直接处理请求而不重定向，默认关闭
+		// eg, //hello///world => /hello/world
+		RemoveExtraSlash bool
+		// 解析 multipart 表单时保存在内存中的上限，超出部分写入临时文件，默认 32 MB
+		MaxMultipartMemory int64
+		// SecureJSON 在顶层数组前添加的前缀，默认 while(1);
+		SecureJSONPrefix string
+		// WebSocket 单条消息的大小上限，超出时以 1009 关闭连接，默认 1 MB
+		MaxWebSocketMessageSize int64
+		// 检查 WebSocket 握手请求的 Origin，为 nil 时只允许与 Host 相同的 Origin
+		CheckOrigin func(r *http.Request) bool
+		// 签名和加密 cookie 的密钥，第一个用于生成，全部用于校验，
+		// 轮换时把新密钥放在最前面，旧密钥保留到已发出的 cookie 过期
+		CookieKeys [][]byte
 	}
 )
 
+// 已注册路由的分组和路由自身的 handlers
+type routeChain struct {
+	n        *node
+	group    *RouterGroup
+	handlers []HandlerFunc
+}
+
+// Any 注册的请求方式
+var anyMethods = []string{
+	http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodHead, http.MethodOptions,
+}
+
 func New() *Engine {
-	engine := &Engine{router: newRouter()}
+	engine := &Engine{
+		router:                  newRouter(),
+		namedRoutes:             make(map[string]string),
+		RedirectTrailingSlash:   true,
+		MaxMultipartMemory:      defaultMultipartMemory,
+		SecureJSONPrefix:        defaultSecureJSONPrefix,
+		MaxWebSocketMessageSize: defaultMaxWebSocketMessageSize,
+	}
 	engine.RouterGroup = &RouterGroup{engine: engine}
-	engine.groups = []*RouterGroup{engine.RouterGroup}
+	engine.pool.New = func() interface{} {
+		return engine.allocateContext()
+	}
+	engine.rebuildFallbacks()
 	return engine
 }
 
@@ -44,13 +102,29 @@ func Default() *Engine {
 	return engine
 }
 
+// 自定义 404 处理函数，与正常路由一样经过中间件
+func (engine *Engine) NoRoute(handlers ...HandlerFunc) {
+	engine.noRoute = handlers
+	engine.rebuildFallbacks()
+}
+
+// 自定义 405 处理函数，执行前已设置好 Allow 响应头
+func (engine *Engine) NoMethod(handlers ...HandlerFunc) {
+	engine.noMethod = handlers
+	engine.rebuildFallbacks()
+}
+
 // 设置自定义渲染函数 funcMap
 func (engine *Engine) SetFuncMap(funcMap template.FuncMap) {
 	engine.funcMap = funcMap
 }
-// 加载模板的方法
+// 加载模板的方法，内置的模板函数(如 csrfField)与 funcMap 合并，同名时以 funcMap 为准
 func (engine *Engine) LoadHTMLGlob(pattern string) {
-	engine.htmlTemplates = template.Must(template.New("").Funcs(engine.funcMap).ParseGlob(pattern))
+	funcMap := template.FuncMap{"csrfField": csrfField}
+	for name, fn := range engine.funcMap {
+		funcMap[name] = fn
+	}
+	engine.htmlTemplates = template.Must(template.New("").Funcs(funcMap).ParseGlob(pattern))
 }
 
 func (group *RouterGroup) Group(prefix string) *RouterGroup {
@@ -60,31 +134,106 @@ func (group *RouterGroup) Group(prefix string) *RouterGroup {
 		parent: group,
 		engine: engine,
 	}
-	engine.groups = append(engine.groups, newGroup)
 	return newGroup
 }
 
-func (group *RouterGroup) addRoute(method string, comp string, handler HandlerFunc) {
+// handlers 中除最后一个外都是只作用于该路由的中间件，在分组中间件之后执行
+func (group *RouterGroup) addRoute(method string, comp string, handlers ...HandlerFunc) *Route {
 	pattern := group.prefix + comp
+	if len(handlers) == 0 {
+		panic(fmt.Sprintf("route %s %s has no handler", method, pattern))
+	}
 	log.Printf("Route %4s - %s", method, pattern)
 	// 实现了路由的映射, engine从某种意义上继承了 RouterGroup的所有属性和方法
-	group.engine.router.addRoute(method, pattern, handler)
+	n := group.engine.router.addRoute(method, pattern, group.combineHandlers(handlers...))
+	group.engine.routeChains = append(group.engine.routeChains, routeChain{n: n, group: group, handlers: handlers})
+	return &Route{pattern: pattern, engine: group.engine}
+}
+
+// 注册任意请求方式的路由
+func (group *RouterGroup) Handle(method string, pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRoute(method, pattern, handlers...)
+}
+
+func (group *RouterGroup) GET(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRoute(http.MethodGet, pattern, handlers...)
+}
+
+func (group *RouterGroup) POST(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRoute(http.MethodPost, pattern, handlers...)
+}
+
+func (group *RouterGroup) PUT(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRoute(http.MethodPut, pattern, handlers...)
+}
+
+func (group *RouterGroup) PATCH(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRoute(http.MethodPatch, pattern, handlers...)
+}
+
+func (group *RouterGroup) DELETE(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRoute(http.MethodDelete, pattern, handlers...)
 }
 
-func (group *RouterGroup) GET(pattern string, handler HandlerFunc) {
-	group.addRoute("GET", pattern, handler)
+func (group *RouterGroup) HEAD(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRoute(http.MethodHead, pattern, handlers...)
 }
 
-func (group *RouterGroup) POST(pattern string, handler HandlerFunc) {
-	group.addRoute("POST", pattern, handler)
+func (group *RouterGroup) OPTIONS(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRoute(http.MethodOptions, pattern, handlers...)
+}
+
+// 为所有常用请求方式注册同一组 handlers
+func (group *RouterGroup) Any(pattern string, handlers ...HandlerFunc) *Route {
+	var route *Route
+	for _, method := range anyMethods {
+		route = group.addRoute(method, pattern, handlers...)
+	}
+	return route
 }
 
 func (engine *Engine) Run(addr string) (err error) {
 	return http.ListenAndServe(addr, engine)
 }
 
+// 注册中间件，对分组及其子分组中的所有路由生效，与注册路由的先后顺序无关，
+// engine 的全局中间件同时作用于未匹配的请求
 func (group *RouterGroup) Use(middlewares ...HandlerFunc) {
 	group.middlewares = append(group.middlewares, middlewares...)
+	engine := group.engine
+	if group == engine.RouterGroup {
+		engine.rebuildFallbacks()
+	}
+	// 之前注册的路由的处理链已经生成，需要重新生成
+	for _, rc := range engine.routeChains {
+		if rc.group.within(group) {
+			rc.n.handlers = rc.group.combineHandlers(rc.handlers...)
+		}
+	}
+}
+
+// group 是否为 ancestor 或其子分组
+func (group *RouterGroup) within(ancestor *RouterGroup) bool {
+	for g := group; g != nil; g = g.parent {
+		if g == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+// 未匹配的请求只经过 engine 的全局中间件，处理链在这里一次生成，避免每个请求重新分配
+func (engine *Engine) rebuildFallbacks() {
+	noRoute, noMethod := engine.noRoute, engine.noMethod
+	if len(noRoute) == 0 {
+		noRoute = []HandlerFunc{serveNotFound}
+	}
+	if len(noMethod) == 0 {
+		noMethod = []HandlerFunc{serveMethodNotAllowed}
+	}
+	engine.allNoRoute = engine.combineHandlers(noRoute...)
+	engine.allNoMethod = engine.combineHandlers(noMethod...)
+	engine.allRedirect = engine.combineHandlers(serveRedirect)
 }
 
 func (group *RouterGroup) createStaticHandler(relativePath string, fs http.FileSystem) HandlerFunc {
@@ -100,22 +249,40 @@ func (group *RouterGroup) createStaticHandler(relativePath string, fs http.FileS
 	}
 }
 // 映射静态文件：用户可以将磁盘上的某个文件夹root映射到路由 relativePath
-func (group *RouterGroup) Static(relativePath string, root string) {
+func (group *RouterGroup) Static(relativePath string, root string) *Route {
 	handler := group.createStaticHandler(relativePath, http.Dir(root))
 	urlPattern := path.Join(relativePath, "/*filepath")
-	group.GET(urlPattern, handler)
+	return group.GET(urlPattern, handler)
 }
 
-func (engine *Engine) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	var middlewares []HandlerFunc
-	// 接收具体请求，判断请求适用于那些中间件
-	for _, group := range engine.groups {
-		if strings.HasPrefix(req.URL.Path, group.prefix) {
-			middlewares = append(middlewares, group.middlewares...)
-		}
+// 注册路由时沿 parent 向上收集中间件，按 engine => 父分组 => 当前分组 的顺序
+// 与路由 handler 拼接成该路由固定的处理链
+func (group *RouterGroup) combineHandlers(handlers ...HandlerFunc) []HandlerFunc {
+	var groups []*RouterGroup
+	for g := group; g != nil; g = g.parent {
+		groups = append(groups, g)
+	}
+	size := len(handlers)
+	for _, g := range groups {
+		size += len(g.middlewares)
 	}
-	c := newContext(w, req)
-	c.handlers = middlewares
-	c.engine = engine
+	merged := make([]HandlerFunc, 0, size)
+	for i := len(groups) - 1; i >= 0; i-- {
+		merged = append(merged, groups[i].middlewares...)
+	}
+	return append(merged, handlers...)
+}
+
+func (engine *Engine) allocateContext() *Context {
+	return &Context{engine: engine, Params: make(Params, 0, engine.router.maxParams)}
+}
+
+func (engine *Engine) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	// 处理链在注册路由时已经确定，由 router 根据匹配结果设置
+	c := engine.pool.Get().(*Context)
+	c.reset(w, req)
 	engine.router.handle(c)
+	// handler 只设置了状态码而没有写 body 时，在这里发送响应头
+	c.Writer.WriteHeaderNow()
+	engine.pool.Put(c)
 }
\ No newline at end of file
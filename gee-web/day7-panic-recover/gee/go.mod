@@ -1,3 +1,7 @@
 module gee
 
 go 1.15
+
+require geecache v0.0.0
+
+replace geecache => ../../../gee-cache/day7-proto-buf/geecache
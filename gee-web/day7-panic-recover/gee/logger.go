@@ -12,6 +12,13 @@ func Logger() HandlerFunc {
 		// process request
 		c.Next()
 		// 计算结果
-		log.Printf("[%d] %s in %v", c.StatusCode, c.Req.RequestURI, time.Since(t))
+		status := ""
+		if c.IsAborted() {
+			status = " (aborted)"
+		}
+		log.Printf("[%d] %s in %v%s", c.Writer.Status(), c.Req.RequestURI, time.Since(t), status)
+		for _, err := range c.Errors {
+			log.Printf("\terror: %v", err)
+		}
 	}
 }
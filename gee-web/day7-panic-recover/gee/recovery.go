@@ -29,6 +29,11 @@ func Recovery() HandlerFunc {
 			if err := recover(); err != nil {
 				message := fmt.Sprintf("%s", err)
 				log.Printf("%s\n\n", trace(message))
+				// 响应头已经发送时无法再返回 500，只终止处理链
+				if c.Writer.Written() {
+					c.Abort()
+					return
+				}
 				c.Fail(http.StatusInternalServerError, "Internal Server Error")
 			}
 		}()
@@ -0,0 +1,381 @@
+package gee
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 响应渲染，Context.Render 先写入 Content-Type 和状态码，再调用 Render 写入 body。
+// 需要序列化的渲染器都先在内存中完成序列化，失败时不会写入不完整的 body
+
+const defaultSecureJSONPrefix = "while(1);"
+
+const (
+	MIMEJSON       = "application/json"
+	MIMEJavaScript = "application/javascript"
+	MIMEXML        = "application/xml"
+	MIMEXML2       = "text/xml"
+	MIMEYAML       = "application/x-yaml"
+	MIMEProtoBuf   = "application/x-protobuf"
+	MIMEPlain      = "text/plain"
+	MIMEHTML       = "text/html"
+)
+
+type Render interface {
+	Render(w http.ResponseWriter) error
+	WriteContentType(w http.ResponseWriter)
+}
+
+func writeContentType(w http.ResponseWriter, value string) {
+	header := w.Header()
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", value)
+	}
+}
+
+// 执行 Template 中名为 Name 的模板
+type HTMLRender struct {
+	Template *template.Template
+	Name     string
+	Data     interface{}
+}
+
+func (r HTMLRender) Render(w http.ResponseWriter) error {
+	if r.Template == nil {
+		return errors.New("html templates are not loaded, call Engine.LoadHTMLGlob first")
+	}
+	var buf bytes.Buffer
+	if err := r.Template.ExecuteTemplate(&buf, r.Name, r.Data); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func (r HTMLRender) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, MIMEHTML)
+}
+
+// 原样写入 Data，ContentType 为空时由 net/http 根据内容推断
+type DataRender struct {
+	ContentType string
+	Data        []byte
+}
+
+func (r DataRender) Render(w http.ResponseWriter) error {
+	_, err := w.Write(r.Data)
+	return err
+}
+
+func (r DataRender) WriteContentType(w http.ResponseWriter) {
+	if r.ContentType != "" {
+		writeContentType(w, r.ContentType)
+	}
+}
+
+type String struct {
+	Format string
+	Data   []interface{}
+}
+
+func (r String) Render(w http.ResponseWriter) error {
+	_, err := fmt.Fprintf(w, r.Format, r.Data...)
+	return err
+}
+
+func (r String) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, MIMEPlain)
+}
+
+type JSON struct {
+	Data interface{}
+}
+
+func (r JSON) Render(w http.ResponseWriter) error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(r.Data); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func (r JSON) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, MIMEJSON)
+}
+
+// 缩进的 JSON，便于调试时阅读
+type IndentedJSON struct {
+	Data interface{}
+}
+
+func (r IndentedJSON) Render(w http.ResponseWriter) error {
+	data, err := json.MarshalIndent(r.Data, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (r IndentedJSON) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, MIMEJSON)
+}
+
+// 顶层为数组的 JSON 加上 Prefix，防止被 <script> 引用时劫持数据
+type SecureJSON struct {
+	Prefix string
+	Data   interface{}
+}
+
+func (r SecureJSON) Render(w http.ResponseWriter) error {
+	data, err := json.Marshal(r.Data)
+	if err != nil {
+		return err
+	}
+	if bytes.HasPrefix(data, []byte("[")) && bytes.HasSuffix(data, []byte("]")) {
+		data = append([]byte(r.Prefix), data...)
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (r SecureJSON) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, MIMEJSON)
+}
+
+// JSONP 的回调函数名只允许 JavaScript 标识符，防止注入脚本
+var jsonpCallbackRegexp = regexp.MustCompile(`^[a-zA-Z_$][a-zA-Z0-9_$.]*$`)
+
+// 以 callback(data); 的形式返回，callback 为空时退化为普通 JSON
+type JSONP struct {
+	Callback string
+	Data     interface{}
+}
+
+func (r JSONP) Render(w http.ResponseWriter) error {
+	data, err := json.Marshal(r.Data)
+	if err != nil {
+		return err
+	}
+	if r.Callback == "" {
+		_, err = w.Write(data)
+		return err
+	}
+	if !jsonpCallbackRegexp.MatchString(r.Callback) {
+		return fmt.Errorf("invalid jsonp callback %q", r.Callback)
+	}
+	var buf bytes.Buffer
+	buf.WriteString(r.Callback + "(")
+	buf.Write(data)
+	buf.WriteString(");")
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+func (r JSONP) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, MIMEJavaScript)
+}
+
+type XML struct {
+	Data interface{}
+}
+
+func (r XML) Render(w http.ResponseWriter) error {
+	data, err := xml.Marshal(r.Data)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (r XML) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, MIMEXML+"; charset=utf-8")
+}
+
+type YAML struct {
+	Data interface{}
+}
+
+func (r YAML) Render(w http.ResponseWriter) error {
+	data, err := marshalYAML(r.Data)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (r YAML) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, MIMEYAML+"; charset=utf-8")
+}
+
+// protobuf 生成的消息实现了 Marshal 方法，例如 gogo/protobuf
+type protoMarshaler interface {
+	Marshal() ([]byte, error)
+}
+
+// Data 为已经编码好的 []byte，或实现了 Marshal() ([]byte, error) 的消息
+type ProtoBuf struct {
+	Data interface{}
+}
+
+func (r ProtoBuf) Render(w http.ResponseWriter) error {
+	var data []byte
+	switch msg := r.Data.(type) {
+	case []byte:
+		data = msg
+	case protoMarshaler:
+		var err error
+		if data, err = msg.Marshal(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("protobuf: unsupported type %T", r.Data)
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func (r ProtoBuf) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, MIMEProtoBuf)
+}
+
+// 写入 Content-Type 和状态码后渲染 body，渲染失败时错误记录在 c.Errors 中并输出到日志。
+// 失败时如果还没有写入 body，改为返回 500，避免返回空 body 的 200；
+// 错误详情(如模板的错误信息)不返回给客户端
+func (c *Context) Render(code int, r Render) {
+	r.WriteContentType(c.Writer)
+	c.Status(code)
+	if err := r.Render(c.Writer); err != nil {
+		log.Printf("render %s: %v", c.Req.URL.Path, err)
+		c.Errors = append(c.Errors, err)
+		if !c.Writer.Written() {
+			http.Error(c.Writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+	}
+}
+
+func (c *Context) IndentedJSON(code int, obj interface{}) {
+	c.Render(code, IndentedJSON{Data: obj})
+}
+
+// 前缀默认为 while(1);，可以通过 Engine.SecureJSONPrefix 修改
+func (c *Context) SecureJSON(code int, obj interface{}) {
+	prefix := defaultSecureJSONPrefix
+	if c.engine != nil {
+		prefix = c.engine.SecureJSONPrefix
+	}
+	c.Render(code, SecureJSON{Prefix: prefix, Data: obj})
+}
+
+// 回调函数名取自 query 参数 callback
+func (c *Context) JSONP(code int, obj interface{}) {
+	c.Render(code, JSONP{Callback: c.Query("callback"), Data: obj})
+}
+
+func (c *Context) XML(code int, obj interface{}) {
+	c.Render(code, XML{Data: obj})
+}
+
+func (c *Context) YAML(code int, obj interface{}) {
+	c.Render(code, YAML{Data: obj})
+}
+
+func (c *Context) ProtoBuf(code int, obj interface{}) {
+	c.Render(code, ProtoBuf{Data: obj})
+}
+
+// 根据 Accept 请求头从 offered 中选择响应格式，按 q 值从高到低匹配，
+// 没有 Accept 时返回 offered[0]，都不可接受时返回空字符串
+func (c *Context) NegotiateFormat(offered ...string) string {
+	if len(offered) == 0 {
+		return ""
+	}
+	accept := c.Req.Header.Get("Accept")
+	if accept == "" {
+		return offered[0]
+	}
+	for _, accepted := range parseAccept(accept) {
+		for _, offer := range offered {
+			if matchMIME(accepted, offer) {
+				return offer
+			}
+		}
+	}
+	return ""
+}
+
+// 按 Accept 选择 JSON、XML 或 YAML 渲染 data，offered 为空时三种都可选，
+// 都不可接受时返回 406
+// eg, c.Negotiate(http.StatusOK, user, gee.MIMEJSON, gee.MIMEXML)
+func (c *Context) Negotiate(code int, data interface{}, offered ...string) {
+	if len(offered) == 0 {
+		offered = []string{MIMEJSON, MIMEXML, MIMEXML2, MIMEYAML}
+	}
+	switch c.NegotiateFormat(offered...) {
+	case MIMEJSON:
+		c.JSON(code, data)
+	case MIMEXML, MIMEXML2:
+		c.XML(code, data)
+	case MIMEYAML:
+		c.YAML(code, data)
+	default:
+		c.AbortWithStatusJSON(http.StatusNotAcceptable, H{
+			"message": "the accepted formats are not offered by the server",
+			"offered": offered,
+		})
+	}
+}
+
+// 解析 Accept，按 q 值降序返回媒体类型，q=0 的被忽略
+func parseAccept(accept string) []string {
+	type acceptItem struct {
+		mime string
+		q    float64
+	}
+	items := make([]acceptItem, 0)
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		item := acceptItem{mime: strings.TrimSpace(fields[0]), q: 1}
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					item.q = q
+				}
+			}
+		}
+		if item.mime != "" && item.q > 0 {
+			items = append(items, item)
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].q > items[j].q })
+	mimes := make([]string, len(items))
+	for i, item := range items {
+		mimes[i] = item.mime
+	}
+	return mimes
+}
+
+// 支持 */* 和 type/* 形式的通配
+func matchMIME(accepted string, offer string) bool {
+	if accepted == "*/*" || accepted == offer {
+		return true
+	}
+	if strings.HasSuffix(accepted, "/*") {
+		return strings.HasPrefix(offer, accepted[:len(accepted)-1])
+	}
+	return false
+}
@@ -0,0 +1,187 @@
+package gee
+
+import (
+	"html/template"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type renderUser struct {
+	Name  string   `json:"name" xml:"name"`
+	Age   int      `json:"age" xml:"age"`
+	Tags  []string `json:"tags,omitempty" xml:"tags"`
+	Email string   `json:"-" xml:"-"`
+}
+
+func TestRenderers(t *testing.T) {
+	r := New()
+	r.htmlTemplates = template.Must(template.New("").Parse(`{{define "hello"}}<b>{{.}}</b>{{end}}`))
+	user := renderUser{Name: "geektutu", Age: 20}
+	r.GET("/xml", func(c *Context) { c.XML(http.StatusOK, user) })
+	r.GET("/indented", func(c *Context) { c.IndentedJSON(http.StatusOK, H{"name": "geektutu"}) })
+	r.GET("/secure", func(c *Context) { c.SecureJSON(http.StatusOK, []int{1, 2}) })
+	r.GET("/jsonp", func(c *Context) { c.JSONP(http.StatusOK, H{"a": 1}) })
+	r.GET("/proto", func(c *Context) { c.ProtoBuf(http.StatusOK, []byte{0x0a, 0x03}) })
+	r.GET("/html", func(c *Context) { c.HTML(http.StatusOK, "hello", "<gee>") })
+	r.GET("/data", func(c *Context) { c.Data(http.StatusOK, []byte("<html></html>")) })
+
+	cases := []struct {
+		path        string
+		contentType string
+		body        string
+	}{
+		{"/xml", "application/xml; charset=utf-8", "<renderUser><name>geektutu</name><age>20</age></renderUser>"},
+		{"/indented", "application/json", "{\n    \"name\": \"geektutu\"\n}"},
+		{"/secure", "application/json", "while(1);[1,2]"},
+		{"/jsonp?callback=cb", "application/javascript", "cb({\"a\":1});"},
+		{"/jsonp", "application/javascript", "{\"a\":1}"},
+		{"/proto", "application/x-protobuf", "\x0a\x03"},
+		{"/html", "text/html", "<b>&lt;gee&gt;</b>"},
+		{"/data", "", "<html></html>"},
+	}
+	for _, tc := range cases {
+		w := performRequest(r, http.MethodGet, tc.path)
+		if w.Header().Get("Content-Type") != tc.contentType || w.Body.String() != tc.body {
+			t.Errorf("%s: got %q %q, want %q %q", tc.path,
+				w.Header().Get("Content-Type"), w.Body.String(), tc.contentType, tc.body)
+		}
+	}
+
+	if w := performRequest(r, http.MethodGet, "/jsonp?callback=alert(1)//"); w.Code != http.StatusInternalServerError ||
+		strings.Contains(w.Body.String(), "alert") {
+		t.Errorf("invalid callback should not be rendered, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestRenderError(t *testing.T) {
+	r := New()
+	r.htmlTemplates = template.Must(template.New("").Parse(`{{define "broken"}}{{.Secret.Field}}{{end}}`))
+	var errs []error
+	r.GET("/nan", func(c *Context) {
+		c.JSON(http.StatusOK, H{"x": math.NaN()})
+		errs = c.Errors
+	})
+	r.GET("/yaml", func(c *Context) { c.YAML(http.StatusOK, make(chan int)) })
+	r.GET("/proto", func(c *Context) { c.ProtoBuf(http.StatusOK, "not a message") })
+	// 模板的错误信息只写入日志，不返回给客户端
+	r.GET("/html", func(c *Context) { c.HTML(http.StatusOK, "broken", H{"Secret": 1}) })
+	r.GET("/missing", func(c *Context) { c.HTML(http.StatusOK, "missing", nil) })
+
+	for _, path := range []string{"/nan", "/yaml", "/proto", "/html", "/missing"} {
+		w := performRequest(r, http.MethodGet, path)
+		if w.Code != http.StatusInternalServerError || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") ||
+			w.Body.String() != "Internal Server Error\n" {
+			t.Errorf("%s: render error should be 500, got %d %q %q", path, w.Code, w.Header().Get("Content-Type"), w.Body.String())
+		}
+	}
+	if len(errs) != 1 {
+		t.Errorf("render error should be recorded, got %v", errs)
+	}
+}
+
+func TestYAML(t *testing.T) {
+	data := H{
+		"name":    "geektutu",
+		"age":     20,
+		"admin":   false,
+		"version": "1.0",
+		"tags":    []string{"go", "web"},
+		"empty":   []string{},
+		"users":   []renderUser{{Name: "jack", Age: 18, Tags: []string{"a"}}},
+		"birth":   time.Date(2019, 8, 17, 0, 0, 0, 0, time.UTC),
+		"nested":  map[string]interface{}{"key": "a: b", "nil": nil},
+		// 会被解析成时间、数字、布尔值的字符串需要加引号
+		"quoted": []string{"2001-12-14", "0x1F", "0o17", "1_000", ".inf", ".NaN", "y", "N", "~", "-1", "/path", "hello world"},
+		"floats": []float64{1.5, math.NaN(), math.Inf(1), math.Inf(-1)},
+		"none":   struct{ hidden int }{},
+		"nones":  []struct{}{{}},
+	}
+	want := `admin: false
+age: 20
+birth: 2019-08-17T00:00:00Z
+empty: []
+floats:
+  - 1.5
+  - .nan
+  - .inf
+  - -.inf
+name: geektutu
+nested:
+  key: "a: b"
+  nil: null
+none: {}
+nones:
+  - {}
+quoted:
+  - "2001-12-14"
+  - "0x1F"
+  - "0o17"
+  - "1_000"
+  - ".inf"
+  - ".NaN"
+  - "y"
+  - "N"
+  - "~"
+  - "-1"
+  - "/path"
+  - hello world
+tags:
+  - go
+  - web
+users:
+  - name: jack
+    age: 18
+    tags:
+      - a
+version: "1.0"
+`
+	got, err := marshalYAML(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Fatalf("unexpected yaml:\n%s\nwant:\n%s", got, want)
+	}
+	if got, _ := marshalYAML(struct{}{}); string(got) != "{}\n" {
+		t.Fatalf("empty struct should be {}, got %q", got)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	r := New()
+	r.GET("/user", func(c *Context) {
+		c.Negotiate(http.StatusOK, renderUser{Name: "geektutu", Age: 20})
+	})
+
+	cases := []struct {
+		accept      string
+		code        int
+		contentType string
+	}{
+		{"", http.StatusOK, "application/json"},
+		{"application/xml", http.StatusOK, "application/xml; charset=utf-8"},
+		{"text/html, application/xml;q=0.9, application/json", http.StatusOK, "application/json"},
+		{"application/json;q=0.5, application/x-yaml", http.StatusOK, "application/x-yaml; charset=utf-8"},
+		{"text/*", http.StatusOK, "application/xml; charset=utf-8"},
+		{"*/*", http.StatusOK, "application/json"},
+		{"text/html", http.StatusNotAcceptable, "application/json"},
+		{"application/json;q=0", http.StatusNotAcceptable, "application/json"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/user", nil)
+		req.Header.Set("Accept", tc.accept)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.code || w.Header().Get("Content-Type") != tc.contentType {
+			t.Errorf("Accept %q: got %d %q, want %d %q", tc.accept,
+				w.Code, w.Header().Get("Content-Type"), tc.code, tc.contentType)
+		}
+		if tc.code == http.StatusOK && !strings.Contains(w.Body.String(), "geektutu") {
+			t.Errorf("Accept %q: unexpected body %q", tc.accept, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package gee
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+)
+
+// 对 http.ResponseWriter 的封装，记录状态码、写入的字节数以及响应头是否已经发送。
+// WriteHeader 只记录状态码，直到第一次写入 body 或请求结束时才真正发送，
+// 因此在写入 body 之前可以多次修改状态码，写入之后的修改会被忽略
+
+const noWritten = -1
+
+type ResponseWriter interface {
+	http.ResponseWriter
+	http.Flusher
+	http.Hijacker
+	http.Pusher
+	http.CloseNotifier
+
+	// 响应的状态码，未设置时为 200
+	Status() int
+	// 已经写入 body 的字节数，未写入时为 -1
+	Size() int
+	// 响应头是否已经发送
+	Written() bool
+	// 立即发送响应头
+	WriteHeaderNow()
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	size   int
+	status int
+	// 指向已废弃的 Context.StatusCode，状态码变化时同步更新
+	statusCode *int
+}
+
+var _ ResponseWriter = &responseWriter{}
+
+func (w *responseWriter) reset(writer http.ResponseWriter) {
+	w.ResponseWriter = writer
+	w.size = noWritten
+	w.status = http.StatusOK
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if code > 0 && !w.Written() {
+		w.status = code
+		if w.statusCode != nil {
+			*w.statusCode = code
+		}
+	}
+}
+
+func (w *responseWriter) WriteHeaderNow() {
+	if !w.Written() {
+		w.size = 0
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+func (w *responseWriter) Write(data []byte) (n int, err error) {
+	w.WriteHeaderNow()
+	n, err = w.ResponseWriter.Write(data)
+	w.size += n
+	return
+}
+
+func (w *responseWriter) WriteString(s string) (n int, err error) {
+	w.WriteHeaderNow()
+	n, err = io.WriteString(w.ResponseWriter, s)
+	w.size += n
+	return
+}
+
+func (w *responseWriter) Status() int {
+	return w.status
+}
+
+func (w *responseWriter) Size() int {
+	return w.size
+}
+
+func (w *responseWriter) Written() bool {
+	return w.size != noWritten
+}
+
+// 底层不支持时什么都不做
+func (w *responseWriter) Flush() {
+	w.WriteHeaderNow()
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// 接管连接后由调用方负责所有读写，响应视为已经发送
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("the ResponseWriter doesn't support the Hijacker interface")
+	}
+	conn, rw, err := hijacker.Hijack()
+	// 接管失败时仍然可以正常返回错误响应
+	if err == nil && w.size < 0 {
+		w.size = 0
+	}
+	return conn, rw, err
+}
+
+// HTTP/2 服务端推送，底层不支持时返回 http.ErrNotSupported
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if pusher, ok := w.ResponseWriter.(http.Pusher); ok {
+		return pusher.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// 已废弃，新代码请使用 Context.Done。底层不支持时返回的 channel 永远不会收到通知
+func (w *responseWriter) CloseNotify() <-chan bool {
+	if notifier, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return notifier.CloseNotify()
+	}
+	return make(chan bool)
+}
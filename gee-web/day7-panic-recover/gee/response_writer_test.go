@@ -0,0 +1,143 @@
+package gee
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResponseWriterStatus(t *testing.T) {
+	r := New()
+	var status, size int
+	r.Use(func(c *Context) {
+		c.Next()
+		status, size = c.Writer.Status(), c.Writer.Size()
+	})
+	r.GET("/raw", func(c *Context) {
+		c.Writer.Write([]byte("hello"))
+	})
+	r.GET("/created", func(c *Context) {
+		c.Status(http.StatusCreated)
+	})
+
+	w := performRequest(r, http.MethodGet, "/raw")
+	if w.Code != http.StatusOK || status != http.StatusOK || size != 5 {
+		t.Fatalf("unexpected status %d %d size %d", w.Code, status, size)
+	}
+	// 只设置状态码时，响应头在请求结束时发送
+	w = performRequest(r, http.MethodGet, "/created")
+	if w.Code != http.StatusCreated || status != http.StatusCreated || size != noWritten {
+		t.Fatalf("unexpected status %d %d size %d", w.Code, status, size)
+	}
+}
+
+func TestContextStatusCode(t *testing.T) {
+	r := New()
+	var code int
+	r.Use(func(c *Context) {
+		c.Next()
+		code = c.StatusCode
+	})
+	r.GET("/created", func(c *Context) {
+		c.String(http.StatusCreated, "ok")
+	})
+	r.GET("/raw", func(c *Context) {
+		c.Writer.WriteHeader(http.StatusAccepted)
+	})
+	r.GET("/redirect", func(c *Context) {
+		http.Redirect(c.Writer, c.Req, "/created", http.StatusFound)
+	})
+	r.GET("/fail", func(c *Context) {
+		c.SetHeader("Content-Type", MIMEHTML)
+		c.Status(http.StatusOK)
+		c.Fail(http.StatusInternalServerError, "failed")
+	})
+
+	// 已废弃的 StatusCode 与 Writer.Status() 保持一致
+	if w := performRequest(r, http.MethodGet, "/created"); w.Code != http.StatusCreated || code != http.StatusCreated {
+		t.Fatalf("StatusCode should follow Writer.Status(), got %d %d", w.Code, code)
+	}
+	// 直接通过 Writer 设置状态码时同样同步
+	for path, want := range map[string]int{"/raw": http.StatusAccepted, "/redirect": http.StatusFound} {
+		if w := performRequest(r, http.MethodGet, path); w.Code != want || code != want {
+			t.Fatalf("%s: StatusCode should follow Writer.Status(), got %d %d", path, w.Code, code)
+		}
+	}
+	// 返回的 JSON 不能带着之前设置的 text/html
+	w := performRequest(r, http.MethodGet, "/fail")
+	if w.Code != http.StatusInternalServerError || code != http.StatusInternalServerError ||
+		w.Header().Get("Content-Type") != MIMEJSON {
+		t.Fatalf("unexpected response %d %d %q", w.Code, code, w.Header().Get("Content-Type"))
+	}
+}
+
+func TestResponseWriterWritten(t *testing.T) {
+	r := New()
+	r.Use(Recovery())
+	r.GET("/partial", func(c *Context) {
+		c.String(http.StatusOK, "partial")
+		panic("boom")
+	})
+	r.GET("/late", func(c *Context) {
+		c.Status(http.StatusAccepted)
+		c.Writer.Write([]byte("ok"))
+		// body 已经写入，之后的状态码被忽略
+		c.Status(http.StatusInternalServerError)
+		if c.Writer.Status() != http.StatusAccepted || !c.Writer.Written() {
+			t.Errorf("status should not change after written, got %d", c.Writer.Status())
+		}
+	})
+
+	w := performRequest(r, http.MethodGet, "/partial")
+	if w.Code != http.StatusOK || w.Body.String() != "partial" {
+		t.Fatalf("recovery should not rewrite a written response, got %d %q", w.Code, w.Body.String())
+	}
+	if w := performRequest(r, http.MethodGet, "/late"); w.Code != http.StatusAccepted {
+		t.Fatalf("unexpected status %d", w.Code)
+	}
+}
+
+type failedHijacker struct {
+	*httptest.ResponseRecorder
+}
+
+func (failedHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, errors.New("hijack failed")
+}
+
+func TestResponseWriterHijackFailed(t *testing.T) {
+	r := New()
+	r.GET("/ws", func(c *Context) {
+		if _, _, err := c.Writer.Hijack(); err == nil || c.Writer.Written() {
+			t.Errorf("failed hijack should not mark the response as written, got %v", err)
+		}
+		c.String(http.StatusInternalServerError, "hijack failed")
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(failedHijacker{w}, httptest.NewRequest(http.MethodGet, "/ws", nil))
+	if w.Code != http.StatusInternalServerError || w.Body.String() != "hijack failed" {
+		t.Fatalf("error response should be sent, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestResponseWriterFlush(t *testing.T) {
+	r := New()
+	r.GET("/flush", func(c *Context) {
+		c.Status(http.StatusAccepted)
+		c.Writer.Flush()
+		if err := c.Writer.Push("/static/app.js", nil); err != http.ErrNotSupported {
+			t.Errorf("push should not be supported by the recorder, got %v", err)
+		}
+		if _, _, err := c.Writer.Hijack(); err == nil {
+			t.Errorf("hijack should fail on the recorder")
+		}
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/flush", nil))
+	if !w.Flushed || w.Code != http.StatusAccepted {
+		t.Fatalf("flush should pass through, got %t %d", w.Flushed, w.Code)
+	}
+}
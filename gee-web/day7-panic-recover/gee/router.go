@@ -1,24 +1,48 @@
 package gee
 
 import (
+	"fmt"
 	"net/http"
+	"path"
+	"sort"
 	"strings"
 )
 
 type router struct {
-	roots map[string]*node				// 存储每种请求方式的Trie树根节点
-	handlers map[string]HandlerFunc		// 存储每种请求方式的HandlerFunc
+	roots     map[string]*node // 存储每种请求方式的Radix树根节点，handler 保存在路由终点上
+	maxParams int              // 单个路由最多的参数个数，用于预分配 Params
 }
 
 // roots key eg, roots['GET'] roots['POST']
-// handlers key eg, handlers['GET-/p/:lang/doc'], handlers['POST-/p/book']
 func newRouter() *router {
 	return &router{
 		roots: make(map[string]*node),
-		handlers: make(map[string]HandlerFunc),
 	}
 }
 
+// 路由参数，按在路由中出现的顺序保存
+type Param struct {
+	Key   string
+	Value string
+}
+
+type Params []Param
+
+// 获取参数 name 的值
+func (ps Params) Get(name string) (string, bool) {
+	for _, p := range ps {
+		if p.Key == name {
+			return p.Value, true
+		}
+	}
+	return "", false
+}
+
+func (ps Params) ByName(name string) string {
+	value, _ := ps.Get(name)
+	return value
+}
+
 // 只有 * 是允许的
 func parsePattern(pattern string) []string {
 	vs := strings.Split(pattern, "/")
@@ -35,57 +59,153 @@ func parsePattern(pattern string) []string {
 	return parts
 }
 
-func (r *router) addRoute(method string, pattern string, handler HandlerFunc) {
+// 注册时校验 pattern：通配参数必须命名，* 只能出现在最后一段
+func validatePattern(pattern string) {
+	catchAll := ""
+	for _, item := range strings.Split(pattern, "/") {
+		if item == "" {
+			continue
+		}
+		if catchAll != "" {
+			panic(fmt.Sprintf("catch-all '%s' in route '%s' must be the last segment", catchAll, pattern))
+		}
+		if item[0] == ':' && len(item) == 1 {
+			panic(fmt.Sprintf("wildcard ':' in route '%s' must be named", pattern))
+		}
+		if item[0] == '*' {
+			catchAll = item
+		}
+	}
+}
+
+// handlers 为包含中间件的完整处理链，返回路由终点
+func (r *router) addRoute(method string, pattern string, handlers []HandlerFunc) *node {
+	validatePattern(pattern)
 	parts := parsePattern(pattern)
 
-	key := method + "-" + pattern
 	_, ok := r.roots[method]
 	if !ok {
 		r.roots[method] = &node{}
 	}
-	r.roots[method].insert(pattern, parts, 0)
-	r.handlers[key] = handler
+	n := r.roots[method].insert(pattern, parts)
+	n.handlers = handlers
+
+	count := 0
+	for _, part := range parts {
+		if part[0] == ':' || part[0] == '*' {
+			count++
+		}
+	}
+	if count > r.maxParams {
+		r.maxParams = count
+	}
+	return n
 }
 
-func (r *router) getRoute(method string, path string) (*node, map[string]string) {
-	searchParts := parsePattern(path)
-	params := make(map[string]string)
-	root, ok := r.roots[method]
+// 合并连续的 / ，例如 //hello///world/ => /hello/world/
+func removeExtraSlash(path string) string {
+	if !strings.Contains(path, "//") {
+		return path
+	}
+	var buf strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '/' && i > 0 && path[i-1] == '/' {
+			continue
+		}
+		buf.WriteByte(path[i])
+	}
+	return buf.String()
+}
 
+// 查找路由，解析出的参数追加到 params 中
+func (r *router) getRoute(method string, path string, params *Params) *node {
+	root, ok := r.roots[method]
 	if !ok {
-		return nil, nil
+		return nil
 	}
+	return root.search(path, params)
+}
 
-	n := root.search(searchParts, 0)
-
-	if n != nil {
-		parts := parsePattern(n.pattern)
-		for index, part := range parts {
-			if part[0] == ':' {
-				params[part[1:]] = searchParts[index]
-			}
-			if part[0] == '*' && len(part) > 1 {
-				params[part[1:]] = strings.Join(searchParts[index:], "/")
-				break
+// 查找可以重定向到的规范路径，找不到时返回空字符串
+func (r *router) redirectPath(engine *Engine, method string, p string) string {
+	root, ok := r.roots[method]
+	if !ok || p == "/" {
+		return ""
+	}
+	params := make(Params, 0, r.maxParams)
+	if engine.RedirectTrailingSlash {
+		if strings.HasSuffix(p, "/") {
+			trimmed := strings.TrimRight(p, "/")
+			if trimmed != "" && root.search(trimmed, &params) != nil {
+				return trimmed
 			}
+		} else if root.searchWithSlash(p) {
+			return p + "/"
+		}
+	}
+	if engine.RedirectFixedPath {
+		if fixed, ok := root.searchCaseInsensitive(path.Clean(p), nil); ok {
+			return string(fixed)
 		}
-		return n, params
 	}
+	return ""
+}
 
-	return nil, nil
+// 查找除 method 以外能匹配 path 的请求方式，按字母序返回
+func (r *router) allowedMethods(method string, path string) []string {
+	var allowed []string
+	for m := range r.roots {
+		if m == method {
+			continue
+		}
+		params := make(Params, 0, r.maxParams)
+		if n := r.getRoute(m, path, &params); n != nil {
+			allowed = append(allowed, m)
+		}
+	}
+	sort.Strings(allowed)
+	return allowed
 }
-// 将解析出来的路由参数复制给 c.params
+
+// 将解析出来的路由参数写入 c.Params
 func (r *router) handle(c *Context) {
-	n, params := r.getRoute(c.Method, c.Path)
+	path := c.Path
+	if c.engine.RemoveExtraSlash {
+		path = removeExtraSlash(path)
+	}
+	n := r.getRoute(c.Method, path, &c.Params)
 
 	if n != nil {
-		key := c.Method + "-" + n.pattern
-		c.Params = params
-		c.handlers = append(c.handlers, r.handlers[key])
+		c.handlers = n.handlers
+	} else if c.redirect = r.redirectPath(c.engine, c.Method, path); c.redirect != "" {
+		c.handlers = c.engine.allRedirect
+	} else if allowed := r.allowedMethods(c.Method, path); len(allowed) > 0 {
+		// 路径在其他请求方式下存在，返回 405 并通过 Allow 告知可用的方式
+		c.SetHeader("Allow", strings.Join(allowed, ", "))
+		c.handlers = c.engine.allNoMethod
 	} else {
-		c.handlers = append(c.handlers, func(c *Context) {
-			c.String(http.StatusNotFound, "404 NOT FOUND: %s\n", c.Path)
-		})
+		c.handlers = c.engine.allNoRoute
 	}
 	c.Next()
-}
\ No newline at end of file
+}
+
+func serveNotFound(c *Context) {
+	c.String(http.StatusNotFound, "404 NOT FOUND: %s\n", c.Path)
+}
+
+func serveMethodNotAllowed(c *Context) {
+	c.String(http.StatusMethodNotAllowed, "405 METHOD NOT ALLOWED: %s %s\n", c.Method, c.Path)
+}
+
+// 重定向到 handle 中找到的规范路径，GET 使用 301，其他请求方式使用 308 以保留请求方式和 body
+func serveRedirect(c *Context) {
+	redirect := c.redirect
+	code := http.StatusMovedPermanently
+	if c.Method != http.MethodGet {
+		code = http.StatusPermanentRedirect
+	}
+	if c.Req.URL.RawQuery != "" {
+		redirect += "?" + c.Req.URL.RawQuery
+	}
+	http.Redirect(c.Writer, c.Req, redirect, code)
+}
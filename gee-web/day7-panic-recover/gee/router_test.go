@@ -0,0 +1,411 @@
+package gee
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func performRequest(engine *Engine, method, path string) *httptest.ResponseRecorder {
+	return performRequestWith(engine, method, path, nil, nil, nil)
+}
+
+// 带上 body、请求头和 cookies 发送请求，body、header、cookies 都可以为 nil
+func performRequestWith(engine *Engine, method, path string, body io.Reader, header http.Header, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, body)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	return w
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	r := New()
+	r.GET("/hello/:name", func(c *Context) {})
+	r.PUT("/hello/:name", func(c *Context) {})
+	r.DELETE("/hello/:name", func(c *Context) {})
+
+	w := performRequest(r, http.MethodPost, "/hello/geektutu")
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("POST /hello/geektutu should be 405, got %d", w.Code)
+	}
+	if allow := w.Header().Get("Allow"); allow != "DELETE, GET, PUT" {
+		t.Fatalf("unexpected Allow header: %q", allow)
+	}
+	if w := performRequest(r, http.MethodPost, "/bye"); w.Code != http.StatusNotFound {
+		t.Fatalf("POST /bye should be 404, got %d", w.Code)
+	}
+}
+
+func TestRedirect(t *testing.T) {
+	r := New()
+	r.GET("/hello/:name", func(c *Context) {})
+	r.POST("/users", func(c *Context) {})
+	r.GET("/docs/", func(c *Context) {})
+	r.GET("/user/:id/", func(c *Context) {})
+	r.GET("/user/:id/profile", func(c *Context) {})
+
+	cases := []struct {
+		method   string
+		path     string
+		code     int
+		location string
+	}{
+		{http.MethodGet, "/hello/geektutu", http.StatusOK, ""},
+		{http.MethodGet, "/hello/geektutu/?a=1", http.StatusMovedPermanently, "/hello/geektutu?a=1"},
+		{http.MethodPost, "/users/", http.StatusPermanentRedirect, "/users"},
+		{http.MethodGet, "/HELLO/Geektutu", http.StatusNotFound, ""},
+		{http.MethodGet, "//hello/geektutu", http.StatusNotFound, ""},
+		{http.MethodGet, "/docs", http.StatusMovedPermanently, "/docs/"},
+		{http.MethodGet, "/docs/", http.StatusOK, ""},
+		{http.MethodGet, "/user/1", http.StatusMovedPermanently, "/user/1/"},
+		{http.MethodGet, "/user/1/profile/", http.StatusMovedPermanently, "/user/1/profile"},
+	}
+	check := func(step string) {
+		for _, tc := range cases {
+			w := performRequest(r, tc.method, tc.path)
+			if w.Code != tc.code || w.Header().Get("Location") != tc.location {
+				t.Errorf("%s: %s %s got %d %q, want %d %q", step, tc.method, tc.path,
+					w.Code, w.Header().Get("Location"), tc.code, tc.location)
+			}
+		}
+	}
+	check("default")
+
+	r.RedirectFixedPath = true
+	cases[3].path = "/A/../HELLO/Geektutu"
+	cases[3].code, cases[3].location = http.StatusMovedPermanently, "/hello/Geektutu"
+	cases[4].code, cases[4].location = http.StatusMovedPermanently, "/hello/geektutu"
+	check("RedirectFixedPath")
+
+	r.RedirectFixedPath = false
+	r.RemoveExtraSlash = true
+	cases[3].code, cases[3].location = http.StatusNotFound, ""
+	cases[4].code, cases[4].location = http.StatusOK, ""
+	check("RemoveExtraSlash")
+}
+
+func TestNoRouteNoMethod(t *testing.T) {
+	r := New()
+	r.Use(func(c *Context) {
+		c.SetHeader("X-Middleware", "global")
+		c.Next()
+	})
+	r.GET("/hello", func(c *Context) {})
+	r.NoRoute(func(c *Context) {
+		c.JSON(http.StatusNotFound, H{"error": "not found", "path": c.Path})
+	})
+	r.NoMethod(func(c *Context) {
+		c.JSON(http.StatusMethodNotAllowed, H{"error": "method not allowed"})
+	})
+
+	w := performRequest(r, http.MethodGet, "/bye")
+	if w.Code != http.StatusNotFound || w.Body.String() != "{\"error\":\"not found\",\"path\":\"/bye\"}\n" {
+		t.Fatalf("unexpected NoRoute response %d %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("X-Middleware") != "global" {
+		t.Fatalf("NoRoute should run through global middleware")
+	}
+
+	w = performRequest(r, http.MethodPost, "/hello")
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "GET" {
+		t.Fatalf("unexpected NoMethod response %d %v", w.Code, w.Header())
+	}
+	if w.Header().Get("X-Middleware") != "global" {
+		t.Fatalf("NoMethod should run through global middleware")
+	}
+}
+
+func TestGroupMiddleware(t *testing.T) {
+	r := New()
+	trace := func(name string) HandlerFunc {
+		return func(c *Context) {
+			c.Writer.Header().Add("X-Trace", name)
+			c.Next()
+		}
+	}
+	r.Use(trace("engine"))
+	v1 := r.Group("/v1")
+	v1.Use(trace("v1"))
+	v1.Group("/users").Use(trace("users"))
+	v1.Group("/users").GET("/:id", func(c *Context) {})
+	users := v1.Group("/users")
+	users.Use(trace("users"))
+	users.GET("/:id/profile", func(c *Context) {})
+	users.GET("/:id/settings", trace("auth"), trace("validate"), func(c *Context) {})
+	r.Group("/v10").GET("/hello", func(c *Context) {})
+
+	cases := map[string]string{
+		"/v1/users/1":          "[engine v1]",
+		"/v1/users/1/profile":  "[engine v1 users]",
+		"/v1/users/1/settings": "[engine v1 users auth validate]",
+		"/v10/hello":           "[engine]",
+		"/v1/none":             "[engine]",
+	}
+	for path, want := range cases {
+		w := performRequest(r, http.MethodGet, path)
+		if got := fmt.Sprint(w.Header()["X-Trace"]); got != want {
+			t.Errorf("%s: middleware %s, want %s", path, got, want)
+		}
+	}
+}
+
+func TestUseAfterRoutes(t *testing.T) {
+	r := New()
+	r.GET("/hello", func(c *Context) {})
+	v1 := r.Group("/v1")
+	v1.GET("/hello", func(c *Context) {})
+	r.Group("/v2").GET("/hello", func(c *Context) {})
+	// 路由注册之后添加的中间件同样生效
+	r.Use(func(c *Context) {
+		c.Writer.Header().Add("X-Trace", "engine")
+		c.Next()
+	})
+	v1.Use(func(c *Context) {
+		c.Writer.Header().Add("X-Trace", "v1")
+		c.Next()
+	})
+
+	cases := map[string]string{
+		"/hello":    "[engine]",
+		"/v1/hello": "[engine v1]",
+		"/v2/hello": "[engine]",
+	}
+	for path, want := range cases {
+		w := performRequest(r, http.MethodGet, path)
+		if got := fmt.Sprint(w.Header()["X-Trace"]); got != want {
+			t.Errorf("%s: middleware %s, want %s", path, got, want)
+		}
+	}
+}
+
+func TestAny(t *testing.T) {
+	r := New()
+	r.Any("/ping", func(c *Context) {
+		c.String(http.StatusOK, c.Method)
+	})
+	for _, method := range anyMethods {
+		w := performRequest(r, method, "/ping")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s /ping should be 200, got %d", method, w.Code)
+		}
+	}
+}
+
+func expectPanic(t *testing.T, name string, f func()) {
+	defer func() {
+		if err := recover(); err == nil {
+			t.Errorf("%s: expected a route conflict panic", name)
+		}
+	}()
+	f()
+}
+
+func TestRouteConflict(t *testing.T) {
+	handlers := []HandlerFunc{func(c *Context) {}}
+	cases := []struct {
+		name     string
+		patterns []string
+	}{
+		{"param names", []string{"/user/:id", "/user/:name"}},
+		{"catch-all names", []string{"/static/*filepath", "/static/*path"}},
+		{"catch-all not last", []string{"/static/*filepath/edit"}},
+		{"duplicate", []string{"/hello", "/hello"}},
+		{"trailing slash", []string{"/hello/", "/hello/"}},
+	}
+	for _, tc := range cases {
+		r := newRouter()
+		expectPanic(t, tc.name, func() {
+			for _, pattern := range tc.patterns {
+				r.addRoute(http.MethodGet, pattern, handlers)
+			}
+		})
+	}
+
+	r := newRouter()
+	r.addRoute(http.MethodGet, "/user/:id", handlers)
+	r.addRoute(http.MethodPost, "/user/:id", handlers)
+	r.addRoute(http.MethodGet, "/user/:id/profile", handlers)
+	// 末尾的 / 是路由的一部分
+	r.addRoute(http.MethodGet, "/hello", handlers)
+	r.addRoute(http.MethodGet, "/hello/", handlers)
+	r.addRoute(http.MethodGet, "/user/:id/", handlers)
+}
+
+func TestRoutePrecedence(t *testing.T) {
+	patterns := []string{"/p/*filepath", "/p/:lang", "/p/doc", "/p/:lang/intro", "/p/doc/intro"}
+	cases := map[string]string{
+		"/p/doc":        "/p/doc",
+		"/p/go":         "/p/:lang",
+		"/p/doc/intro":  "/p/doc/intro",
+		"/p/go/intro":   "/p/:lang/intro",
+		"/p/go/other":   "/p/*filepath",
+		"/p/doc/other":  "/p/*filepath",
+		"/p/go/a/intro": "/p/*filepath",
+	}
+	// 正序、逆序注册得到的结果必须一致
+	for _, reverse := range []bool{false, true} {
+		r := newRouter()
+		for i := range patterns {
+			pattern := patterns[i]
+			if reverse {
+				pattern = patterns[len(patterns)-1-i]
+			}
+			r.addRoute(http.MethodGet, pattern, []HandlerFunc{func(c *Context) {}})
+		}
+		for path, want := range cases {
+			params := make(Params, 0)
+			n := r.getRoute(http.MethodGet, path, &params)
+			if n == nil || n.pattern != want {
+				t.Errorf("reverse=%t: %s should match %s, got %v", reverse, path, want, n)
+			}
+		}
+	}
+}
+
+func TestGetRoute(t *testing.T) {
+	r := newRouter()
+	handlers := []HandlerFunc{func(c *Context) {}}
+	r.addRoute(http.MethodGet, "/", handlers)
+	r.addRoute(http.MethodGet, "/hello/:name", handlers)
+	r.addRoute(http.MethodGet, "/hello/b/c", handlers)
+	r.addRoute(http.MethodGet, "/hi/:name", handlers)
+	r.addRoute(http.MethodGet, "/assets/*filepath", handlers)
+
+	cases := []struct {
+		path    string
+		pattern string
+		params  Params
+	}{
+		{"/", "/", Params{}},
+		{"/hello/geektutu", "/hello/:name", Params{{"name", "geektutu"}}},
+		{"/hello/b", "/hello/:name", Params{{"name", "b"}}},
+		{"/hello/b/c", "/hello/b/c", Params{}},
+		{"/hi/b", "/hi/:name", Params{{"name", "b"}}},
+		{"/hello/geektutu/", "", nil},
+		{"//hello/geektutu", "", nil},
+		{"/assets/css/geektutu.css", "/assets/*filepath", Params{{"filepath", "css/geektutu.css"}}},
+		{"/assets", "", nil},
+		{"/hello", "", nil},
+		{"/hello/b/c/d", "", nil},
+	}
+	for _, tc := range cases {
+		params := make(Params, 0)
+		n := r.getRoute(http.MethodGet, tc.path, &params)
+		if n == nil {
+			if tc.pattern != "" {
+				t.Errorf("%s should match %s", tc.path, tc.pattern)
+			}
+			continue
+		}
+		if n.pattern != tc.pattern || fmt.Sprint(params) != fmt.Sprint(tc.params) {
+			t.Errorf("%s: got %s %v, want %s %v", tc.path, n.pattern, params, tc.pattern, tc.params)
+		}
+	}
+}
+
+// 模拟一组 REST 接口，共 20 * 15 = 300 条路由
+func benchmarkRouter() *router {
+	r := newRouter()
+	handlers := []HandlerFunc{func(c *Context) {}}
+	templates := []string{
+		"/%s", "/%s/search", "/%s/recent", "/%s/:id", "/%s/:id/edit",
+		"/%s/:id/comments", "/%s/:id/comments/:cid", "/%s/:id/tags", "/%s/:id/tags/:tag",
+		"/%s/:id/history", "/%s/:id/history/:rev", "/%s/:id/owners", "/%s/:id/owners/:uid",
+		"/%s/:id/raw/*filepath", "/%s/export/csv",
+	}
+	for i := 0; i < 20; i++ {
+		resource := fmt.Sprintf("resource%d", i)
+		for _, tpl := range templates {
+			r.addRoute(http.MethodGet, fmt.Sprintf(tpl, resource), handlers)
+		}
+	}
+	return r
+}
+
+func TestGetRouteAllocs(t *testing.T) {
+	r := benchmarkRouter()
+	params := make(Params, 0, r.maxParams)
+	allocs := testing.AllocsPerRun(100, func() {
+		params = params[:0]
+		r.getRoute(http.MethodGet, "/resource17/42/comments/7", &params)
+	})
+	if allocs != 0 {
+		t.Fatalf("getRoute should not allocate, got %v allocs", allocs)
+	}
+}
+
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardWriter) WriteHeader(int)             {}
+
+// 未匹配的请求复用注册时生成的处理链，不会每次分配
+func TestNoRouteAllocs(t *testing.T) {
+	r := New()
+	r.GET("/hello", func(c *Context) {})
+	r.NoRoute(func(c *Context) {
+		c.Status(http.StatusNotFound)
+	})
+	// NoRoute 之后注册的全局中间件同样生效
+	var count int
+	r.Use(func(c *Context) {
+		count++
+		c.Next()
+	})
+	req := httptest.NewRequest(http.MethodGet, "/bye", nil)
+	w := &discardWriter{header: make(http.Header)}
+	allocs := testing.AllocsPerRun(100, func() {
+		r.ServeHTTP(w, req)
+	})
+	if allocs != 0 || count == 0 {
+		t.Fatalf("404 should not allocate, got %v allocs, middleware ran %d times", allocs, count)
+	}
+}
+
+func benchmarkGetRoute(b *testing.B, path string) {
+	r := benchmarkRouter()
+	params := make(Params, 0, r.maxParams)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		params = params[:0]
+		if r.getRoute(http.MethodGet, path, &params) == nil {
+			b.Fatalf("%s not found", path)
+		}
+	}
+}
+
+func BenchmarkRouterStatic(b *testing.B) {
+	benchmarkGetRoute(b, "/resource17/export/csv")
+}
+
+func BenchmarkRouterParam(b *testing.B) {
+	benchmarkGetRoute(b, "/resource17/42/comments/7")
+}
+
+func BenchmarkRouterCatchAll(b *testing.B) {
+	benchmarkGetRoute(b, "/resource17/42/raw/docs/readme.md")
+}
+
+func BenchmarkRouterServeHTTP(b *testing.B) {
+	engine := New()
+	engine.router = benchmarkRouter()
+	req := httptest.NewRequest(http.MethodGet, "/resource17/42/comments/7", nil)
+	w := httptest.NewRecorder()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		engine.ServeHTTP(w, req)
+	}
+}
@@ -0,0 +1,52 @@
+package gee
+
+import (
+	"net/http"
+	"reflect"
+	"runtime"
+	"sort"
+)
+
+// 已注册路由的信息
+type RouteInfo struct {
+	Method      string `json:"method"`
+	Path        string `json:"path"`        // 包含分组前缀的完整路由
+	Handler     string `json:"handler"`     // handler 的函数名
+	Middlewares int    `json:"middlewares"` // 该路由生效的中间件个数
+}
+
+// 返回所有已注册的路由，按路径、请求方式排序
+func (engine *Engine) Routes() []RouteInfo {
+	routes := make([]RouteInfo, 0)
+	for method, root := range engine.router.roots {
+		list := make([]*node, 0)
+		root.travel(&list)
+		for _, n := range list {
+			routes = append(routes, RouteInfo{
+				Method:      method,
+				Path:        n.pattern,
+				Handler:     nameOfFunction(n.handlers[len(n.handlers)-1]),
+				Middlewares: len(n.handlers) - 1,
+			})
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+// 以 JSON 形式输出路由表，需要手动注册
+// eg, r.GET("/debug/routes", r.RoutesHandler())
+func (engine *Engine) RoutesHandler() HandlerFunc {
+	return func(c *Context) {
+		c.JSON(http.StatusOK, engine.Routes())
+	}
+}
+
+func nameOfFunction(f interface{}) string {
+	return runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+}
@@ -0,0 +1,39 @@
+package gee
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func helloHandler(c *Context) {}
+
+func TestRoutes(t *testing.T) {
+	r := New()
+	r.Use(func(c *Context) {})
+	v1 := r.Group("/v1")
+	v1.Use(func(c *Context) {})
+	v1.GET("/hello/:name", helloHandler)
+	v1.POST("/hello/:name", helloHandler)
+	r.GET("/debug/routes", r.RoutesHandler())
+
+	want := []RouteInfo{
+		{http.MethodGet, "/debug/routes", "gee.(*Engine).RoutesHandler.func1", 1},
+		{http.MethodGet, "/v1/hello/:name", "gee.helloHandler", 2},
+		{http.MethodPost, "/v1/hello/:name", "gee.helloHandler", 2},
+	}
+
+	w := performRequest(r, http.MethodGet, "/debug/routes")
+	var got []RouteInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("route %d: got %v, want %v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package gee
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/gob"
+	"io"
+	"net/http"
+	"time"
+)
+
+// 会话，由 Sessions 中间件在请求开始时加载，handler 通过 Session(c) 读写:
+//
+//	r.Use(gee.Sessions("gee_session", gee.NewMemoryStore(), gee.SessionOptions{}))
+//	r.POST("/login", func(c *gee.Context) {
+//		s := gee.Session(c)
+//		s.Regenerate() // 登录后更换会话 id，防止会话固定攻击
+//		s.Set("user", "geektutu")
+//		s.AddFlash("welcome back")
+//		s.Save()
+//	})
+//
+// 修改后需要在写入 body 之前调用 Save，会话数据使用 encoding/gob 序列化，
+// 存入自定义类型时需要先调用 gob.Register
+
+const (
+	defaultSessionIdleTimeout     = 30 * time.Minute
+	defaultSessionAbsoluteTimeout = 24 * time.Hour
+	sessionContextKey             = "gee/session"
+)
+
+type SessionOptions struct {
+	// 超过该时间没有保存过的会话失效，默认 30 分钟
+	IdleTimeout time.Duration
+	// 从创建起超过该时间的会话失效，默认 24 小时
+	AbsoluteTimeout time.Duration
+	// 会话 cookie 的属性，Path 默认为 /，SameSite 默认为 Lax，cookie 总是 HttpOnly
+	Path     string
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
+}
+
+// 保存会话数据的后端。cookie 中保存的是 Save 返回的值，
+// 对服务端存储来说通常就是会话 id，对 CookieStore 来说是加密后的会话数据
+type Store interface {
+	// 根据 cookie 中的值读取会话数据，不存在或已过期时返回 nil, nil
+	Load(c *Context, value string) ([]byte, error)
+	// 保存会话数据，ttl 后可以丢弃，返回写入 cookie 的值
+	Save(c *Context, id string, data []byte, ttl time.Duration) (string, error)
+	// 删除 cookie 中的值对应的会话数据
+	Delete(c *Context, value string) error
+}
+
+// 序列化到 Store 中的会话数据
+type sessionRecord struct {
+	ID       string
+	Created  time.Time
+	LastSeen time.Time
+	Values   map[string]interface{}
+	Flashes  []interface{}
+}
+
+type SessionData struct {
+	c       *Context
+	name    string
+	store   Store
+	options *SessionOptions
+	value   string // 当前 cookie 中的值，新会话为空
+	record  sessionRecord
+}
+
+// 会话中间件，name 为 cookie 名。会话在请求开始时加载，
+// 空闲时间超过 IdleTimeout 的一半时自动保存一次，使活跃的会话不会因空闲超时失效
+func Sessions(name string, store Store, options SessionOptions) HandlerFunc {
+	if store == nil {
+		panic("nil session Store")
+	}
+	if options.IdleTimeout <= 0 {
+		options.IdleTimeout = defaultSessionIdleTimeout
+	}
+	if options.AbsoluteTimeout <= 0 {
+		options.AbsoluteTimeout = defaultSessionAbsoluteTimeout
+	}
+	if options.Path == "" {
+		options.Path = "/"
+	}
+	if options.SameSite == 0 {
+		options.SameSite = http.SameSiteLaxMode
+	}
+	return func(c *Context) {
+		s := &SessionData{c: c, name: name, store: store, options: &options}
+		if err := s.load(); err != nil {
+			c.Errors = append(c.Errors, err)
+		}
+		if s.value != "" && time.Since(s.record.LastSeen) > options.IdleTimeout/2 {
+			if err := s.Save(); err != nil {
+				c.Errors = append(c.Errors, err)
+			}
+		}
+		c.Set(sessionContextKey, s)
+		c.Next()
+	}
+}
+
+// 返回当前请求的会话，没有使用 Sessions 中间件时 panic
+func Session(c *Context) *SessionData {
+	s, ok := c.Get(sessionContextKey)
+	if !ok {
+		panic("gee: Sessions middleware is not installed")
+	}
+	return s.(*SessionData)
+}
+
+// 读取 cookie 对应的会话，不存在、无法解析或已过期时创建新会话
+func (s *SessionData) load() error {
+	s.reset()
+	value, err := s.c.Cookie(s.name)
+	if err != nil || value == "" {
+		return nil
+	}
+	data, err := s.store.Load(s.c, value)
+	if err != nil || data == nil {
+		return err
+	}
+	var record sessionRecord
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&record); err != nil {
+		return err
+	}
+	now := time.Now()
+	if now.Sub(record.LastSeen) > s.options.IdleTimeout || now.Sub(record.Created) > s.options.AbsoluteTimeout {
+		return s.store.Delete(s.c, value)
+	}
+	if record.Values == nil {
+		record.Values = make(map[string]interface{})
+	}
+	s.value, s.record = value, record
+	return nil
+}
+
+func (s *SessionData) reset() {
+	now := time.Now()
+	s.value = ""
+	s.record = sessionRecord{
+		ID:       newSessionID(),
+		Created:  now,
+		LastSeen: now,
+		Values:   make(map[string]interface{}),
+	}
+}
+
+func newSessionID() string {
+	b := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (s *SessionData) ID() string {
+	return s.record.ID
+}
+
+// 会话是否是本次请求新建的，即还没有保存过
+func (s *SessionData) IsNew() bool {
+	return s.value == ""
+}
+
+func (s *SessionData) Get(key string) interface{} {
+	return s.record.Values[key]
+}
+
+func (s *SessionData) Set(key string, value interface{}) {
+	s.record.Values[key] = value
+}
+
+func (s *SessionData) Delete(key string) {
+	delete(s.record.Values, key)
+}
+
+// 清空所有的值和 flash 消息，会话 id 不变
+func (s *SessionData) Clear() {
+	s.record.Values = make(map[string]interface{})
+	s.record.Flashes = nil
+}
+
+// 添加只读取一次的 flash 消息，通常用于重定向后的提示
+func (s *SessionData) AddFlash(value interface{}) {
+	s.record.Flashes = append(s.record.Flashes, value)
+}
+
+// 返回并清空 flash 消息，需要调用 Save 才会从 Store 中删除
+func (s *SessionData) Flashes() []interface{} {
+	flashes := s.record.Flashes
+	s.record.Flashes = nil
+	return flashes
+}
+
+// 保存会话并设置 cookie，需要在写入 body 之前调用
+func (s *SessionData) Save() error {
+	now := time.Now()
+	s.record.LastSeen = now
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&s.record); err != nil {
+		return err
+	}
+	ttl := s.options.IdleTimeout
+	if remaining := s.record.Created.Add(s.options.AbsoluteTimeout).Sub(now); remaining < ttl {
+		ttl = remaining
+	}
+	value, err := s.store.Save(s.c, s.record.ID, buf.Bytes(), ttl)
+	if err != nil {
+		return err
+	}
+	// Store 每次保存返回新的值时，删除旧值对应的数据
+	if s.value != "" && s.value != value {
+		if err := s.store.Delete(s.c, s.value); err != nil {
+			return err
+		}
+	}
+	s.value = value
+	s.setCookie(value, int(s.record.Created.Add(s.options.AbsoluteTimeout).Sub(now)/time.Second))
+	return nil
+}
+
+// 更换会话 id 并保存，保留会话中的值，旧 id 对应的数据被删除。
+// 登录、提升权限后应调用，防止会话固定攻击。
+// 创建时间保持不变，更换 id 不能延长 AbsoluteTimeout
+func (s *SessionData) Regenerate() error {
+	s.record.ID = newSessionID()
+	return s.Save()
+}
+
+// 删除会话数据并让浏览器删除 cookie，通常用于退出登录
+func (s *SessionData) Destroy() error {
+	var err error
+	if s.value != "" {
+		err = s.store.Delete(s.c, s.value)
+	}
+	s.reset()
+	s.setCookie("", -1)
+	return err
+}
+
+func (s *SessionData) setCookie(value string, maxAge int) {
+	s.c.SetCookie(&http.Cookie{
+		Name:     s.name,
+		Value:    value,
+		Path:     s.options.Path,
+		Domain:   s.options.Domain,
+		MaxAge:   maxAge,
+		Secure:   s.options.Secure,
+		HttpOnly: true,
+		SameSite: s.options.SameSite,
+	})
+}
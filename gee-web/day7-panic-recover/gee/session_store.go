@@ -0,0 +1,174 @@
+package gee
+
+import (
+	"fmt"
+	"geecache"
+	"sync"
+	"time"
+)
+
+// 内置的会话 Store
+
+// 浏览器对单个 cookie 的大小限制
+const maxCookieSize = 4096
+
+// 会话数据加密后直接保存在 cookie 中，不需要服务端存储，密钥取自 Engine.CookieKeys。
+// 数据不能超过 4 KB，删除只能通过让浏览器删除 cookie 实现，
+// 因此被窃取的 cookie 在过期之前一直有效
+type CookieStore struct{}
+
+func NewCookieStore() CookieStore {
+	return CookieStore{}
+}
+
+func (CookieStore) Load(c *Context, value string) ([]byte, error) {
+	keys, err := c.cookieKeys()
+	if err != nil {
+		return nil, err
+	}
+	data, err := decryptCookie(keys, "gee-session", value)
+	if err == ErrInvalidCookie {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (CookieStore) Save(c *Context, id string, data []byte, ttl time.Duration) (string, error) {
+	keys, err := c.cookieKeys()
+	if err != nil {
+		return "", err
+	}
+	value, err := encryptCookie(keys, "gee-session", data)
+	if err != nil {
+		return "", err
+	}
+	if len(value) > maxCookieSize {
+		return "", fmt.Errorf("gee: session is too large for a cookie (%d bytes)", len(value))
+	}
+	return value, nil
+}
+
+func (CookieStore) Delete(c *Context, value string) error {
+	return nil
+}
+
+type memorySession struct {
+	data    []byte
+	expires time.Time
+}
+
+// 保存在进程内存中的会话，只适用于单节点，重启后会话丢失
+type MemoryStore struct {
+	mu        sync.Mutex
+	sessions  map[string]memorySession
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: make(map[string]memorySession), lastSweep: time.Now()}
+}
+
+func (m *MemoryStore) Load(c *Context, id string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok || time.Now().After(s.expires) {
+		return nil, nil
+	}
+	return s.data, nil
+}
+
+// 每分钟最多清理一次过期的会话
+func (m *MemoryStore) Save(c *Context, id string, data []byte, ttl time.Duration) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if now.Sub(m.lastSweep) > time.Minute {
+		for key, s := range m.sessions {
+			if now.After(s.expires) {
+				delete(m.sessions, key)
+			}
+		}
+		m.lastSweep = now
+	}
+	m.sessions[id] = memorySession{data: data, expires: now.Add(ttl)}
+	return id, nil
+}
+
+func (m *MemoryStore) Delete(c *Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	return nil
+}
+
+// 会话数据的持久化存储，即 geecache.Group 的 Getter 读取的数据源，
+// 由使用者基于数据库、Redis 等所有节点共享的存储实现
+type SessionSource interface {
+	// key 不存在时返回错误
+	Get(key string) ([]byte, error)
+	// ttl 后可以丢弃
+	Put(key string, data []byte, ttl time.Duration) error
+	Delete(key string) error
+}
+
+// 基于 geecache 的 Store，多个节点通过 geecache 共享会话。
+// geecache 中的值不会更新也不能删除，因此每次保存都以新的 key (id.版本) 写入 source，
+// 再在 source 中把 id 指向这个版本。cookie 中保存的是不变的会话 id，
+// 并发的请求各自保存时以最后一次为准，不会因 cookie 被覆盖而丢失会话。
+// 读取时先从 source 读取当前版本，再通过 group 读取该版本的数据。
+// 当前版本会被更新，放进 geecache 后无法失效，所以每次请求都直接读 source，
+// 只有不会再改变的会话数据经过缓存；这样 Destroy、Regenerate 后旧 cookie 立即失效，
+// 即使旧数据仍留在各节点的缓存中。被替换的旧版本不会主动删除，在 ttl 后由 source 丢弃。
+// group 的 Getter 需要从同一个 source 读取:
+//
+//	group := geecache.NewGroup("sessions", 64<<20, geecache.GetterFunc(source.Get))
+//	store := gee.NewCacheStore(group, source)
+//	r.Use(gee.Sessions("gee_session", store, gee.SessionOptions{}))
+type CacheStore struct {
+	group  *geecache.Group
+	source SessionSource
+}
+
+func NewCacheStore(group *geecache.Group, source SessionSource) *CacheStore {
+	if group == nil || source == nil {
+		panic("nil geecache.Group or SessionSource")
+	}
+	return &CacheStore{group: group, source: source}
+}
+
+// 会话不存在、已被删除时返回 nil, nil
+func (s *CacheStore) Load(c *Context, id string) ([]byte, error) {
+	key, err := s.source.Get(id)
+	if err != nil {
+		return nil, nil
+	}
+	data, err := s.group.Get(string(key))
+	if err != nil {
+		return nil, nil
+	}
+	return data.ByteSlice(), nil
+}
+
+// 先写入数据再更新当前版本，其他节点不会读到不存在的版本
+func (s *CacheStore) Save(c *Context, id string, data []byte, ttl time.Duration) (string, error) {
+	key := id + "." + newSessionID()[:11]
+	if err := s.source.Put(key, data, ttl); err != nil {
+		return "", err
+	}
+	if err := s.source.Put(id, []byte(key), ttl); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (s *CacheStore) Delete(c *Context, id string) error {
+	key, err := s.source.Get(id)
+	if err != nil {
+		return nil
+	}
+	if err := s.source.Delete(id); err != nil {
+		return err
+	}
+	return s.source.Delete(string(key))
+}
@@ -0,0 +1,224 @@
+package gee
+
+import (
+	"errors"
+	"geecache"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newSessionEngine(store Store, options SessionOptions) *Engine {
+	r := New()
+	r.CookieKeys = [][]byte{[]byte("secret")}
+	r.Use(Sessions("gee_session", store, options))
+	r.GET("/login", func(c *Context) {
+		s := Session(c)
+		s.Regenerate()
+		s.Set("user", c.Query("user"))
+		s.AddFlash("welcome")
+		s.Save()
+	})
+	r.GET("/me", func(c *Context) {
+		s := Session(c)
+		user, _ := s.Get("user").(string)
+		flashes := s.Flashes()
+		s.Save()
+		c.String(http.StatusOK, "%s %v", user, flashes)
+	})
+	r.GET("/logout", func(c *Context) {
+		Session(c).Destroy()
+	})
+	return r
+}
+
+// 用响应中的 Set-Cookie 更新 cookies
+func updateCookies(cookies map[string]*http.Cookie, resp *http.Response) []*http.Cookie {
+	for _, cookie := range resp.Cookies() {
+		if cookie.MaxAge < 0 {
+			delete(cookies, cookie.Name)
+		} else {
+			cookies[cookie.Name] = cookie
+		}
+	}
+	list := make([]*http.Cookie, 0, len(cookies))
+	for _, cookie := range cookies {
+		list = append(list, cookie)
+	}
+	return list
+}
+
+func testSessionStore(t *testing.T, store Store) {
+	r := newSessionEngine(store, SessionOptions{})
+	jar := make(map[string]*http.Cookie)
+
+	w := performRequestWith(r, http.MethodGet, "/login?user=geektutu", nil, nil, nil)
+	cookies := updateCookies(jar, w.Result())
+	loginCookie := jar["gee_session"]
+	if loginCookie == nil || !loginCookie.HttpOnly || loginCookie.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("unexpected session cookie %v", loginCookie)
+	}
+
+	w = performRequestWith(r, http.MethodGet, "/me", nil, nil, cookies)
+	if w.Body.String() != "geektutu [welcome]" {
+		t.Fatalf("unexpected session %q", w.Body.String())
+	}
+	// flash 只读取一次
+	cookies = updateCookies(jar, w.Result())
+	if w = performRequestWith(r, http.MethodGet, "/me", nil, nil, cookies); w.Body.String() != "geektutu []" {
+		t.Fatalf("flash should be consumed, got %q", w.Body.String())
+	}
+
+	cookies = updateCookies(jar, w.Result())
+	w = performRequestWith(r, http.MethodGet, "/logout", nil, nil, cookies)
+	updateCookies(jar, w.Result())
+	if jar["gee_session"] != nil {
+		t.Fatalf("logout should delete the cookie")
+	}
+	if w = performRequestWith(r, http.MethodGet, "/me", nil, nil, nil); w.Body.String() != " []" {
+		t.Fatalf("unexpected session %q", w.Body.String())
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	testSessionStore(t, store)
+
+	// 退出登录后，旧 cookie 无法再使用
+	r := newSessionEngine(store, SessionOptions{})
+	w := performRequest(r, http.MethodGet, "/login?user=geektutu")
+	cookies := w.Result().Cookies()
+	performRequestWith(r, http.MethodGet, "/logout", nil, nil, cookies)
+	if w := performRequestWith(r, http.MethodGet, "/me", nil, nil, cookies); w.Body.String() != " []" {
+		t.Fatalf("destroyed session should not be loaded, got %q", w.Body.String())
+	}
+}
+
+func TestCookieStore(t *testing.T) {
+	testSessionStore(t, NewCookieStore())
+}
+
+// 模拟 geecache.Group: 读取时先查缓存，未命中再从数据源加载，缓存中的值不会更新
+// 模拟 geecache: source 是所有节点共享的数据源，cache 中的值一旦读取就不会更新或删除
+type fakeSessionSource struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func (src *fakeSessionSource) Get(key string) ([]byte, error) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	v, ok := src.data[key]
+	if !ok {
+		return nil, errors.New(key + " not exist")
+	}
+	return v, nil
+}
+
+func (src *fakeSessionSource) Put(key string, data []byte, ttl time.Duration) error {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	src.data[key] = data
+	return nil
+}
+
+func (src *fakeSessionSource) Delete(key string) error {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	delete(src.data, key)
+	return nil
+}
+
+func TestCacheStore(t *testing.T) {
+	source := &fakeSessionSource{data: make(map[string][]byte)}
+	group := geecache.NewGroup("gee-sessions", 1<<20, geecache.GetterFunc(source.Get))
+	store := NewCacheStore(group, source)
+	testSessionStore(t, store)
+
+	// 旧数据仍在缓存中，但退出登录、更换 id 后旧 cookie 都无法再使用
+	r := newSessionEngine(store, SessionOptions{})
+	w := performRequest(r, http.MethodGet, "/login?user=geektutu")
+	loggedIn := updateCookies(make(map[string]*http.Cookie), w.Result())
+	w = performRequestWith(r, http.MethodGet, "/me", nil, nil, loggedIn)
+	if w.Body.String() != "geektutu [welcome]" {
+		t.Fatalf("unexpected session %q", w.Body.String())
+	}
+	loggedIn = updateCookies(make(map[string]*http.Cookie), w.Result())
+	w = performRequestWith(r, http.MethodGet, "/login?user=geektutu", nil, nil, loggedIn)
+	regenerated := updateCookies(make(map[string]*http.Cookie), w.Result())
+	if w := performRequestWith(r, http.MethodGet, "/me", nil, nil, loggedIn); w.Body.String() != " []" {
+		t.Fatalf("regenerated session should not be loaded by the old cookie, got %q", w.Body.String())
+	}
+
+	// 并发保存同一个会话，每个响应中的 cookie 都仍然有效
+	var wg sync.WaitGroup
+	responses := make([]*http.Response, 8)
+	for i := range responses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i] = performRequestWith(r, http.MethodGet, "/me", nil, nil, regenerated).Result()
+		}(i)
+	}
+	wg.Wait()
+	for _, resp := range responses {
+		cookies := updateCookies(make(map[string]*http.Cookie), resp)
+		if w := performRequestWith(r, http.MethodGet, "/me", nil, nil, cookies); w.Body.String() != "geektutu []" {
+			t.Fatalf("concurrent saves should keep the session, got %q", w.Body.String())
+		}
+	}
+
+	performRequestWith(r, http.MethodGet, "/logout", nil, nil, regenerated)
+	if w := performRequestWith(r, http.MethodGet, "/me", nil, nil, regenerated); w.Body.String() != " []" {
+		t.Fatalf("destroyed session should not be loaded, got %q", w.Body.String())
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	store := NewMemoryStore()
+	r := newSessionEngine(store, SessionOptions{IdleTimeout: 200 * time.Millisecond, AbsoluteTimeout: 500 * time.Millisecond})
+	r.GET("/sudo", func(c *Context) {
+		Session(c).Regenerate()
+	})
+	w := performRequest(r, http.MethodGet, "/login?user=geektutu")
+	jar := make(map[string]*http.Cookie)
+	cookies := updateCookies(jar, w.Result())
+
+	// 持续访问时不会因空闲超时失效，更换 id 也不会延长绝对超时
+	for i := 0; i < 4; i++ {
+		time.Sleep(100 * time.Millisecond)
+		w = performRequestWith(r, http.MethodGet, "/sudo", nil, nil, cookies)
+		cookies = updateCookies(jar, w.Result())
+		w = performRequestWith(r, http.MethodGet, "/me", nil, nil, cookies)
+		if w.Body.String()[:8] != "geektutu" {
+			t.Fatalf("active session should not expire, got %q", w.Body.String())
+		}
+		cookies = updateCookies(jar, w.Result())
+	}
+	// 空闲时间未超时，但超过绝对超时后失效
+	time.Sleep(150 * time.Millisecond)
+	if w = performRequestWith(r, http.MethodGet, "/me", nil, nil, cookies); w.Body.String() != " []" {
+		t.Fatalf("session should expire after the absolute timeout, got %q", w.Body.String())
+	}
+
+	w = performRequest(r, http.MethodGet, "/login?user=geektutu")
+	cookies = w.Result().Cookies()
+	time.Sleep(300 * time.Millisecond)
+	if w = performRequestWith(r, http.MethodGet, "/me", nil, nil, cookies); w.Body.String() != " []" {
+		t.Fatalf("idle session should expire, got %q", w.Body.String())
+	}
+}
+
+func TestSessionWithoutMiddleware(t *testing.T) {
+	r := New()
+	r.GET("/", func(c *Context) {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Session should panic without the middleware")
+			}
+		}()
+		Session(c)
+	})
+	performRequest(r, http.MethodGet, "/")
+}
@@ -0,0 +1,124 @@
+package gee
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Server-Sent Events，按 text/event-stream 格式写入事件:
+//   id: 42
+//   event: progress
+//   retry: 3000
+//   data: {"percent":50}
+// 每个事件以空行结束，写入后立即 Flush 发送给客户端
+
+const MIMEEventStream = "text/event-stream"
+
+// 单个事件，Data 为 string 或 []byte 时原样输出，其余类型编码为 JSON。
+// Retry 为客户端断线后重连的等待时间（毫秒），为 0 时不输出
+type SSE struct {
+	Event string
+	ID    string
+	Retry uint
+	Data  interface{}
+}
+
+// 换行会被当作字段的结束，event、id 中的换行直接去掉，防止注入其他字段
+var sseReplacer = strings.NewReplacer("\n", "", "\r", "")
+
+// \r\n、\r、\n 都是 SSE 的换行，拆分 data 前统一为 \n
+var sseNewlineReplacer = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+func (r SSE) Render(w http.ResponseWriter) error {
+	var buf bytes.Buffer
+	if r.ID != "" {
+		buf.WriteString("id: " + sseReplacer.Replace(r.ID) + "\n")
+	}
+	if r.Event != "" {
+		buf.WriteString("event: " + sseReplacer.Replace(r.Event) + "\n")
+	}
+	if r.Retry > 0 {
+		buf.WriteString("retry: " + strconv.FormatUint(uint64(r.Retry), 10) + "\n")
+	}
+	var data string
+	switch d := r.Data.(type) {
+	case nil:
+	case string:
+		data = d
+	case []byte:
+		data = string(d)
+	default:
+		b, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+		data = string(b)
+	}
+	// 多行数据拆分为多个 data 字段，客户端会用换行重新拼接
+	data = sseNewlineReplacer.Replace(data)
+	for _, line := range strings.Split(data, "\n") {
+		buf.WriteString("data: " + line + "\n")
+	}
+	buf.WriteString("\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func (r SSE) WriteContentType(w http.ResponseWriter) {
+	header := w.Header()
+	header.Set("Content-Type", MIMEEventStream)
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	// 关闭 nginx 的缓冲，否则事件会积攒到缓冲区满才发送
+	header.Set("X-Accel-Buffering", "no")
+}
+
+// 发送一个事件并立即 Flush
+// eg, c.SSEvent("progress", gee.H{"percent": 50})
+func (c *Context) SSEvent(name string, data interface{}) {
+	c.SSEventWith(SSE{Event: name, Data: data})
+}
+
+// 发送带 id、retry 的事件，客户端重连时会通过 Last-Event-ID 带回最后收到的 id
+func (c *Context) SSEventWith(event SSE) {
+	c.Render(http.StatusOK, event)
+	c.Writer.Flush()
+}
+
+// 客户端断线重连时带回的最后一个事件 id，首次连接时为空
+func (c *Context) LastEventID() string {
+	return c.Req.Header.Get("Last-Event-ID")
+}
+
+// 循环调用 step 直到其返回 false 或客户端断开连接，每次调用后 Flush。
+// 客户端断开时返回 true，step 中等待数据时也应同时监听 c.Done()
+// eg,
+//
+//	c.Stream(func(w io.Writer) bool {
+//		select {
+//		case job := <-updates:
+//			c.SSEvent("progress", job)
+//			return !job.Done
+//		case <-c.Done():
+//			return false
+//		}
+//	})
+func (c *Context) Stream(step func(w io.Writer) bool) bool {
+	done := c.Done()
+	for {
+		select {
+		case <-done:
+			return true
+		default:
+			keepOpen := step(c.Writer)
+			c.Writer.Flush()
+			if !keepOpen {
+				return c.Err() != nil
+			}
+		}
+	}
+}
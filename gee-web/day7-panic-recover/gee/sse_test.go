@@ -0,0 +1,74 @@
+package gee
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSSEvent(t *testing.T) {
+	r := New()
+	r.GET("/events", func(c *Context) {
+		if c.LastEventID() != "41" {
+			t.Errorf("unexpected Last-Event-ID %q", c.LastEventID())
+		}
+		c.SSEventWith(SSE{ID: "42", Retry: 3000, Event: "progress", Data: H{"percent": 50}})
+		c.SSEvent("log", "line1\nline2")
+		// 单独的 \r 也是换行，不能借此注入 event 等字段
+		c.SSEvent("x", "a\revent: admin\r\ndata: forged")
+	})
+	req := httptest.NewRequest(http.MethodGet, "/events", nil)
+	req.Header.Set("Last-Event-ID", "41")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	expected := "id: 42\nevent: progress\nretry: 3000\ndata: {\"percent\":50}\n\n" +
+		"event: log\ndata: line1\ndata: line2\n\n" +
+		"event: x\ndata: a\ndata: event: admin\ndata: data: forged\n\n"
+	if w.Body.String() != expected {
+		t.Fatalf("unexpected body %q", w.Body.String())
+	}
+	if w.Header().Get("Content-Type") != MIMEEventStream || w.Header().Get("Cache-Control") != "no-cache" || !w.Flushed {
+		t.Fatalf("unexpected headers %v", w.Header())
+	}
+}
+
+func TestStream(t *testing.T) {
+	r := New()
+	var disconnected bool
+	r.GET("/stream", func(c *Context) {
+		i := 0
+		disconnected = c.Stream(func(w io.Writer) bool {
+			i++
+			c.SSEvent("tick", i)
+			return i < 3
+		})
+	})
+	w := performRequest(r, http.MethodGet, "/stream")
+	if disconnected || w.Body.String() != "event: tick\ndata: 1\n\nevent: tick\ndata: 2\n\nevent: tick\ndata: 3\n\n" {
+		t.Fatalf("unexpected stream %t %q", disconnected, w.Body.String())
+	}
+
+	// 客户端断开后停止调用 step
+	ctx, cancel := context.WithCancel(context.Background())
+	r.GET("/forever", func(c *Context) {
+		n := 0
+		disconnected = c.Stream(func(w io.Writer) bool {
+			n++
+			if n == 2 {
+				cancel()
+			}
+			return true
+		})
+		if n != 2 {
+			t.Errorf("step should stop after disconnect, called %d times", n)
+		}
+	})
+	req := httptest.NewRequest(http.MethodGet, "/forever", nil).WithContext(ctx)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	if !disconnected {
+		t.Fatalf("Stream should report the disconnect")
+	}
+}
@@ -0,0 +1,115 @@
+package gee
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+)
+
+// 分块流式响应，用于导出大量数据时边生成边发送，不在内存中缓存整个响应。
+// 响应头发送后无法再修改状态码，中途出错时通过 trailer 中的 X-Stream-Error 告知客户端
+
+const (
+	MIMENDJSON = "application/x-ndjson"
+	MIMECSV    = "text/csv"
+)
+
+const StreamErrorTrailer = "X-Stream-Error"
+
+const (
+	chunkFlushSize     = 32 << 10 // 32 KB
+	chunkFlushInterval = time.Second
+)
+
+// 累计写入超过 chunkFlushSize 或距离上次 Flush 超过 chunkFlushInterval 时 Flush，
+// 客户端断开后写入返回 context 的错误
+type chunkWriter struct {
+	c         *Context
+	pending   int
+	lastFlush time.Time
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	if err := w.c.Err(); err != nil {
+		return 0, err
+	}
+	n, err := w.c.Writer.Write(p)
+	w.pending += n
+	if w.pending >= chunkFlushSize || time.Since(w.lastFlush) >= chunkFlushInterval {
+		w.Flush()
+	}
+	return n, err
+}
+
+func (w *chunkWriter) Flush() {
+	w.c.Writer.Flush()
+	w.pending = 0
+	w.lastFlush = time.Now()
+}
+
+// 以 contentType 流式返回 fn 写入的数据，传给 fn 的 w 同时实现了 http.Flusher。
+// fn 返回的错误或客户端断开的错误会记录在 c.Errors 中，并写入 trailer
+// eg,
+//
+//	c.StreamChunked(http.StatusOK, gee.MIMECSV, func(w io.Writer) error {
+//		cw := csv.NewWriter(w)
+//		for rows.Next() {
+//			...
+//			cw.Write(record)
+//		}
+//		cw.Flush()
+//		return cw.Error()
+//	})
+func (c *Context) StreamChunked(code int, contentType string, fn func(w io.Writer) error) error {
+	header := c.Writer.Header()
+	header.Set("Content-Type", contentType)
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Add("Trailer", StreamErrorTrailer)
+	c.Status(code)
+
+	w := &chunkWriter{c: c, lastFlush: time.Now()}
+	err := fn(w)
+	if err == nil {
+		err = c.Err()
+	}
+	w.Flush()
+	if err != nil {
+		header.Set(StreamErrorTrailer, err.Error())
+		c.Errors = append(c.Errors, err)
+	}
+	return err
+}
+
+// 将 ch 中的值逐行编码为 JSON 返回，直到 ch 关闭或客户端断开。
+// 发送到 ch 中的 error 会中止输出并写入 trailer。
+// ch 暂时没有数据时先 Flush 已写入的行，避免客户端长时间收不到数据
+func (c *Context) StreamJSONLines(ch <-chan interface{}) error {
+	return c.StreamChunked(http.StatusOK, MIMENDJSON, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		done := c.Done()
+		for {
+			var item interface{}
+			var ok bool
+			select {
+			case item, ok = <-ch:
+			default:
+				w.(http.Flusher).Flush()
+				select {
+				case item, ok = <-ch:
+				case <-done:
+					return c.Err()
+				}
+			}
+			if !ok {
+				return nil
+			}
+			if err, isErr := item.(error); isErr {
+				return err
+			}
+			if err := enc.Encode(item); err != nil {
+				return err
+			}
+		}
+	})
+}
@@ -0,0 +1,86 @@
+package gee
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStreamJSONLines(t *testing.T) {
+	r := New()
+	r.GET("/export", func(c *Context) {
+		ch := make(chan interface{})
+		go func() {
+			defer close(ch)
+			for i := 1; i <= 3; i++ {
+				ch <- H{"id": i}
+			}
+		}()
+		c.StreamJSONLines(ch)
+	})
+	r.GET("/broken", func(c *Context) {
+		ch := make(chan interface{}, 2)
+		ch <- H{"id": 1}
+		ch <- errors.New("database gone")
+		c.StreamJSONLines(ch)
+	})
+
+	w := performRequest(r, http.MethodGet, "/export")
+	if w.Body.String() != "{\"id\":1}\n{\"id\":2}\n{\"id\":3}\n" || w.Header().Get("Content-Type") != MIMENDJSON {
+		t.Fatalf("unexpected body %q", w.Body.String())
+	}
+	if trailer := w.Result().Trailer.Get(StreamErrorTrailer); trailer != "" {
+		t.Fatalf("unexpected trailer %q", trailer)
+	}
+
+	w = performRequest(r, http.MethodGet, "/broken")
+	if w.Body.String() != "{\"id\":1}\n" || w.Result().Trailer.Get(StreamErrorTrailer) != "database gone" {
+		t.Fatalf("mid-stream error should be reported as trailer, got %q %v", w.Body.String(), w.Result().Trailer)
+	}
+}
+
+func TestStreamChunked(t *testing.T) {
+	r := New()
+	r.GET("/users.csv", func(c *Context) {
+		c.StreamChunked(http.StatusOK, MIMECSV, func(w io.Writer) error {
+			cw := csv.NewWriter(w)
+			cw.Write([]string{"id", "name"})
+			cw.Write([]string{"1", "geektutu"})
+			cw.Flush()
+			return cw.Error()
+		})
+	})
+	w := performRequest(r, http.MethodGet, "/users.csv")
+	if w.Body.String() != "id,name\n1,geektutu\n" || !w.Flushed {
+		t.Fatalf("unexpected body %q", w.Body.String())
+	}
+
+	// 客户端断开后写入失败，错误记录在 c.Errors 中
+	ctx, cancel := context.WithCancel(context.Background())
+	var streamErr error
+	r.GET("/forever", func(c *Context) {
+		streamErr = c.StreamChunked(http.StatusOK, MIMECSV, func(w io.Writer) error {
+			for i := 0; ; i++ {
+				if i == 2 {
+					cancel()
+				}
+				if _, err := io.WriteString(w, "row\n"); err != nil {
+					return err
+				}
+			}
+		})
+		if len(c.Errors) != 1 {
+			t.Errorf("stream error should be recorded, got %v", c.Errors)
+		}
+	})
+	req := httptest.NewRequest(http.MethodGet, "/forever", nil).WithContext(ctx)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if streamErr != context.Canceled || w.Body.String() != "row\nrow\n" {
+		t.Fatalf("unexpected result %v %q", streamErr, w.Body.String())
+	}
+}
@@ -5,55 +5,267 @@ import (
 	"strings"
 )
 
-// 使用Trie树实现动态路由解析
+// 使用压缩前缀树(Radix Tree)实现动态路由解析
+// 连续的静态部分合并为一个节点，例如 /p/doc 与 /p/docs 共享 /p/doc 前缀，
+// :param 和 *wildcard 各自单独成为节点，挂在以 / 结尾的节点下
+
+type nodeType uint8
+
+const (
+	static   nodeType = iota // 静态节点，path 为压缩后的前缀
+	param                    // :param 节点，匹配一个完整的路径段
+	catchAll                 // *wildcard 节点，匹配剩余的全部路径
+)
 
 type node struct {
-	pattern  string		// 待匹配路由 例如 /p/:lang
-	part     string		// 路由中的一部分，例如 :lang
-	children []*node	// 子节点，例如 [doc, tutorial, intro]
-	isWild   bool		//是否精确匹配，part 含有 : 或 * 时为true
+	pattern   string        // 待匹配路由 例如 /p/:lang，非空表示路由终点
+	path      string        // 静态节点为压缩后的前缀，例如 /p/；通配节点为 :lang 或 *filepath
+	nType     nodeType      // 节点类型
+	indices   string        // 静态子节点 path 的首字节，与 children 一一对应
+	children  []*node       // 静态子节点
+	wildChild *node         // :param 子节点，同一层最多一个
+	catchAll  *node         // *wildcard 子节点，同一层最多一个
+	handlers  []HandlerFunc // 路由终点的完整处理链，包含中间件
 }
 
 func (n *node) String() string {
-	return fmt.Sprintf("node{pattern=%s, part=%s, isWild=%t}", n.pattern, n.part, n.isWild)
+	return fmt.Sprintf("node{pattern=%s, path=%s, nType=%d}", n.pattern, n.path, n.nType)
 }
-// 节点的插入
-func (n *node) insert(pattern string, parts []string, height int) {
-	if len(parts) == height {
-		n.pattern = pattern
-		return
+
+// 节点的插入，parts 为 parsePattern 解析出的路由片段，返回路由终点。
+// 末尾的 / 是路由的一部分，/users 与 /users/ 是两个不同的路由
+func (n *node) insert(pattern string, parts []string) *node {
+	trailingSlash := len(parts) > 0 && strings.HasSuffix(pattern, "/") && parts[len(parts)-1][0] != '*'
+	cur := n
+	prefix := "/"
+	for i, part := range parts {
+		last := i == len(parts)-1
+		if part[0] == ':' || part[0] == '*' {
+			cur = cur.addStatic(prefix)
+			cur = cur.addWild(pattern, part)
+			prefix = ""
+			if !last || trailingSlash {
+				prefix = "/"
+			}
+			continue
+		}
+		prefix += part
+		if !last || trailingSlash {
+			prefix += "/"
+		}
+	}
+	if prefix != "" {
+		cur = cur.addStatic(prefix)
 	}
 
-	part := parts[height]
-	child := n.matchChild(part)
-	if child == nil {
-		child = &node{part: part, isWild: part[0] == ':' || part[0] == '*'}
+	if cur.pattern != "" {
+		panic(fmt.Sprintf("route '%s' conflicts with existing route '%s'", pattern, cur.pattern))
+	}
+	cur.pattern = pattern
+	return cur
+}
+
+// 在 n 下插入静态前缀 s，必要时拆分已有节点，返回 s 结束处的节点
+func (n *node) addStatic(s string) *node {
+	i := strings.IndexByte(n.indices, s[0])
+	if i < 0 {
+		child := &node{path: s, nType: static}
+		n.indices += string(s[0])
 		n.children = append(n.children, child)
+		return child
+	}
+
+	child := n.children[i]
+	l := longestCommonPrefix(child.path, s)
+	if l < len(child.path) {
+		// 拆分：公共前缀成为新节点，child 下移到新节点之下，
+		// 已注册路由的节点地址保持不变
+		prefix := &node{
+			path:     child.path[:l],
+			nType:    static,
+			indices:  string(child.path[l]),
+			children: []*node{child},
+		}
+		child.path = child.path[l:]
+		n.children[i] = prefix
+		child = prefix
+	}
+	if l == len(s) {
+		return child
+	}
+	return child.addStatic(s[l:])
+}
+
+// 在 n 下插入通配节点 part，同一层只能有一个 :param 和一个 *wildcard，
+// 名字不同的参数无法区分，总有一个路由取不到期望的参数
+func (n *node) addWild(pattern string, part string) *node {
+	child, nType := &n.wildChild, param
+	if part[0] == '*' {
+		child, nType = &n.catchAll, catchAll
+	}
+	if *child != nil {
+		if (*child).path != part {
+			panic(fmt.Sprintf("segment '%s' in route '%s' conflicts with '%s' in existing route '%s'",
+				part, pattern, (*child).path, (*child).anyPattern()))
+		}
+		return *child
 	}
-	child.insert(pattern, parts, height+1)
+	*child = &node{path: part, nType: nType}
+	return *child
 }
-// 节点的查询
-func (n *node) search(parts []string, height int) *node {
-	if len(parts) == height || strings.HasPrefix(n.part, "*") {
-		if n.pattern == "" {
+
+func longestCommonPrefix(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// 节点的查询，匹配优先级为 精确 > :param > *wildcard，子树匹配失败时回溯尝试下一个。
+// 解析出的参数追加到 params 中，匹配失败时 params 恢复原状，查找过程不分配内存
+func (n *node) search(path string, params *Params) *node {
+	mark := len(*params)
+	switch n.nType {
+	case static:
+		if !strings.HasPrefix(path, n.path) {
+			return nil
+		}
+		path = path[len(n.path):]
+	case param:
+		end := strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+		if end == 0 {
+			return nil
+		}
+		*params = append(*params, Param{Key: n.path[1:], Value: path[:end]})
+		path = path[end:]
+	case catchAll:
+		if path == "" {
 			return nil
 		}
+		if len(n.path) > 1 {
+			*params = append(*params, Param{Key: n.path[1:], Value: path})
+		}
 		return n
 	}
 
-	part := parts[height]
-	children := n.matchChildren(part)
+	if path == "" {
+		if n.pattern != "" {
+			return n
+		}
+		*params = (*params)[:mark]
+		return nil
+	}
 
-	for _, child := range children {
-		result := child.search(parts, height+1)
-		if result != nil {
+	if i := strings.IndexByte(n.indices, path[0]); i >= 0 {
+		if result := n.children[i].search(path, params); result != nil {
+			return result
+		}
+	}
+	if n.wildChild != nil {
+		if result := n.wildChild.search(path, params); result != nil {
+			return result
+		}
+	}
+	if n.catchAll != nil {
+		if result := n.catchAll.search(path, params); result != nil {
 			return result
 		}
 	}
 
+	*params = (*params)[:mark]
 	return nil
 }
 
+// path 补上末尾的 / 后能否匹配，只在 RedirectTrailingSlash 时使用，不分配内存
+func (n *node) searchWithSlash(path string) bool {
+	switch n.nType {
+	case static:
+		if len(n.path) == len(path)+1 && n.path[len(path)] == '/' && strings.HasPrefix(n.path, path) {
+			return n.pattern != ""
+		}
+		if !strings.HasPrefix(path, n.path) {
+			return false
+		}
+		path = path[len(n.path):]
+	case param:
+		end := strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+		if end == 0 {
+			return false
+		}
+		path = path[end:]
+	case catchAll:
+		// 补上 / 之前就已经能匹配
+		return false
+	}
+
+	if path == "" {
+		i := strings.IndexByte(n.indices, '/')
+		return i >= 0 && n.children[i].path == "/" && n.children[i].pattern != ""
+	}
+	if i := strings.IndexByte(n.indices, path[0]); i >= 0 && n.children[i].searchWithSlash(path) {
+		return true
+	}
+	if n.wildChild != nil && n.wildChild.searchWithSlash(path) {
+		return true
+	}
+	return false
+}
+
+// 忽略大小写查找路由，成功时返回按注册路由修正大小写后的路径，
+// 参数部分保持原样。只在 RedirectFixedPath 时使用，不追求零分配
+func (n *node) searchCaseInsensitive(path string, buf []byte) ([]byte, bool) {
+	switch n.nType {
+	case static:
+		if len(path) < len(n.path) || !strings.EqualFold(path[:len(n.path)], n.path) {
+			return nil, false
+		}
+		buf = append(buf, n.path...)
+		path = path[len(n.path):]
+	case param:
+		end := strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+		if end == 0 {
+			return nil, false
+		}
+		buf = append(buf, path[:end]...)
+		path = path[end:]
+	case catchAll:
+		if path == "" {
+			return nil, false
+		}
+		return append(buf, path...), true
+	}
+
+	if path == "" {
+		return buf, n.pattern != ""
+	}
+	for _, child := range n.children {
+		if result, ok := child.searchCaseInsensitive(path, buf); ok {
+			return result, true
+		}
+	}
+	if n.wildChild != nil {
+		if result, ok := n.wildChild.searchCaseInsensitive(path, buf); ok {
+			return result, true
+		}
+	}
+	if n.catchAll != nil {
+		if result, ok := n.catchAll.searchCaseInsensitive(path, buf); ok {
+			return result, true
+		}
+	}
+	return nil, false
+}
+
 func (n *node) travel(list *([]*node)) {
 	if n.pattern != "" {
 		*list = append(*list, n)
@@ -61,23 +273,20 @@ func (n *node) travel(list *([]*node)) {
 	for _, child := range n.children {
 		child.travel(list)
 	}
-}
-// 第一个匹配成功的节点，用于插入
-func (n *node) matchChild(part string) *node {
-	for _, child := range n.children {
-		if child.part == part || child.isWild {
-			return child
-		}
+	if n.wildChild != nil {
+		n.wildChild.travel(list)
+	}
+	if n.catchAll != nil {
+		n.catchAll.travel(list)
 	}
-	return nil
 }
-// 所有匹配成功的节点，用于查找
-func (n *node) matchChildren(part string) []*node {
-	nodes := make([]*node, 0)
-	for _, child := range n.children {
-		if child.part == part || child.isWild {
-			nodes = append(nodes, child)
-		}
+
+// 子树中任意一个已注册的路由，用于冲突提示
+func (n *node) anyPattern() string {
+	list := make([]*node, 0)
+	n.travel(&list)
+	if len(list) == 0 {
+		return n.path
 	}
-	return nodes
-}
\ No newline at end of file
+	return list[0].pattern
+}
@@ -0,0 +1,93 @@
+package gee
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 文件上传
+// 解析 multipart/form-data 时，超过 Engine.MaxMultipartMemory 的部分由标准库写入临时文件，
+// 请求结束后由 net/http 自动清理；SaveUploadedFile 通过 io.Copy 流式写入目标文件，
+// 因此大文件不会被完整读入内存
+
+func (c *Context) maxMultipartMemory() int64 {
+	if c.engine != nil && c.engine.MaxMultipartMemory > 0 {
+		return c.engine.MaxMultipartMemory
+	}
+	return defaultMultipartMemory
+}
+
+// 解析并返回 multipart 表单，重复调用只解析一次。
+// body 超出 BodyLimit 的限制时(如没有 Content-Length 的 chunked 请求)直接返回 413
+func (c *Context) MultipartForm() (*multipart.Form, error) {
+	if c.Req.MultipartForm == nil {
+		if err := c.Req.ParseMultipartForm(c.maxMultipartMemory()); err != nil {
+			if isBodyTooLarge(err) {
+				c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, H{"message": err.Error()})
+			}
+			return nil, err
+		}
+	}
+	return c.Req.MultipartForm, nil
+}
+
+// http.MaxBytesReader 超出限制时返回的错误，go1.19 之前没有导出的错误类型
+func isBodyTooLarge(err error) bool {
+	return strings.Contains(err.Error(), "http: request body too large")
+}
+
+// 返回表单中 name 对应的第一个文件
+func (c *Context) FormFile(name string) (*multipart.FileHeader, error) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil, err
+	}
+	files := form.File[name]
+	if len(files) == 0 {
+		return nil, http.ErrMissingFile
+	}
+	return files[0], nil
+}
+
+// 将上传的文件保存到 dst，目录不存在时自动创建
+func (c *Context) SaveUploadedFile(file *multipart.FileHeader, dst string) error {
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err = os.MkdirAll(filepath.Dir(dst), 0750); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, src)
+	return err
+}
+
+// 限制请求 body 的大小，可以作为单个路由的中间件使用
+// eg, r.POST("/upload", gee.BodyLimit(500<<20), handler)
+// Content-Length 超出时直接返回 413，否则读取超出 limit 时返回错误
+func BodyLimit(limit int64) HandlerFunc {
+	return func(c *Context) {
+		if c.Req.ContentLength > limit {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge,
+				H{"message": fmt.Sprintf("request body exceeds %d bytes", limit)})
+			return
+		}
+		if c.Req.Body != nil {
+			c.Req.Body = http.MaxBytesReader(c.Writer, c.Req.Body, limit)
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,82 @@
+package gee
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newUploadRequest(t *testing.T, field, filename string, content []byte) *http.Request {
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	fw, err := mw.CreateFormFile(field, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(content)
+	mw.WriteField("owner", "geektutu")
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/upload", body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestUpload(t *testing.T) {
+	dir := t.TempDir()
+	content := bytes.Repeat([]byte("gee"), 1024)
+
+	r := New()
+	// 内存上限很小，文件内容会写入临时文件
+	r.MaxMultipartMemory = 64
+	r.POST("/upload", BodyLimit(1<<20), func(c *Context) {
+		file, err := c.FormFile("file")
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		if err := c.SaveUploadedFile(file, filepath.Join(dir, c.PostForm("owner"), file.Filename)); err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		c.String(http.StatusOK, "%d", file.Size)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, newUploadRequest(t, "file", "a.txt", content))
+	if w.Code != http.StatusOK {
+		t.Fatalf("upload failed with %d", w.Code)
+	}
+	saved, err := ioutil.ReadFile(filepath.Join(dir, "geektutu", "a.txt"))
+	if err != nil || !bytes.Equal(saved, content) {
+		t.Fatalf("saved file mismatch, err %v", err)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, newUploadRequest(t, "other", "a.txt", content))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("missing file should be 400, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, newUploadRequest(t, "file", "big.txt", make([]byte, 2<<20)))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized body should be 413, got %d", w.Code)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "geektutu", "big.txt")); !os.IsNotExist(err) {
+		t.Fatalf("oversized file should not be saved")
+	}
+
+	// chunked 请求没有 Content-Length，读取超出限制时同样返回 413
+	req := newUploadRequest(t, "file", "chunked.txt", make([]byte, 2<<20))
+	req.ContentLength = -1
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized chunked body should be 413, got %d", w.Code)
+	}
+}
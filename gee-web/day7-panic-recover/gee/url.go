@@ -0,0 +1,72 @@
+package gee
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// 注册路由后返回，用于给路由命名
+// eg, r.GET("/hello/:name", handler).Name("hello")
+type Route struct {
+	pattern string // 包含分组前缀的完整路由
+	engine  *Engine
+}
+
+// 给路由命名，之后可以通过 Engine.URL 反向生成路径，名字重复时 panic
+func (route *Route) Name(name string) *Route {
+	engine := route.engine
+	if pattern, ok := engine.namedRoutes[name]; ok {
+		panic(fmt.Sprintf("route name '%s' is already used by '%s'", name, pattern))
+	}
+	engine.namedRoutes[name] = route.pattern
+	return route
+}
+
+// 根据路由名生成路径，params 为 key, value 交替的参数列表，
+// 必须提供路由中所有的 :param 和 *wildcard，且不能多余
+// eg, engine.URL("hello", "name", "geektutu") => /v1/hello/geektutu
+//
+// URL 可以直接作为模板函数使用:
+// engine.SetFuncMap(template.FuncMap{"url": engine.URL})
+// {{url "hello" "name" .Name}}
+func (engine *Engine) URL(name string, params ...string) (string, error) {
+	pattern, ok := engine.namedRoutes[name]
+	if !ok {
+		return "", fmt.Errorf("route '%s' not found", name)
+	}
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("route '%s': params must be key, value pairs", name)
+	}
+	values := make(map[string]string, len(params)/2)
+	for i := 0; i < len(params); i += 2 {
+		values[params[i]] = params[i+1]
+	}
+
+	parts := parsePattern(pattern)
+	for i, part := range parts {
+		if part[0] != ':' && part[0] != '*' {
+			continue
+		}
+		key := part[1:]
+		value, ok := values[key]
+		if !ok || value == "" {
+			return "", fmt.Errorf("route '%s' requires parameter '%s'", name, key)
+		}
+		delete(values, key)
+		if part[0] == ':' {
+			parts[i] = url.PathEscape(value)
+			continue
+		}
+		// *wildcard 可以包含多级路径，逐段转义
+		segments := strings.Split(strings.TrimPrefix(value, "/"), "/")
+		for j, segment := range segments {
+			segments[j] = url.PathEscape(segment)
+		}
+		parts[i] = strings.Join(segments, "/")
+	}
+	for key := range values {
+		return "", fmt.Errorf("route '%s' has no parameter '%s'", name, key)
+	}
+	return "/" + strings.Join(parts, "/"), nil
+}
@@ -0,0 +1,41 @@
+package gee
+
+import (
+	"html/template"
+	"strings"
+	"testing"
+)
+
+func TestURL(t *testing.T) {
+	r := New()
+	v1 := r.Group("/v1")
+	v1.GET("/hello/:name", func(c *Context) {}).Name("hello")
+	v1.GET("/files/:owner/*filepath", func(c *Context) {}).Name("file")
+
+	if u, err := r.URL("hello", "name", "gee tutu"); err != nil || u != "/v1/hello/gee%20tutu" {
+		t.Fatalf("unexpected url %q, err %v", u, err)
+	}
+	if u, err := r.URL("file", "owner", "jack", "filepath", "css/a.css"); err != nil || u != "/v1/files/jack/css/a.css" {
+		t.Fatalf("unexpected url %q, err %v", u, err)
+	}
+
+	errCases := [][]string{
+		{"unknown"},
+		{"hello"},
+		{"hello", "name"},
+		{"hello", "name", "geektutu", "id", "1"},
+		{"file", "owner", "jack"},
+	}
+	for _, args := range errCases {
+		if _, err := r.URL(args[0], args[1:]...); err == nil {
+			t.Errorf("URL%v should fail", args)
+		}
+	}
+
+	r.SetFuncMap(template.FuncMap{"url": r.URL})
+	tmpl := template.Must(template.New("").Funcs(r.funcMap).Parse(`{{url "hello" "name" .}}`))
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, "geektutu"); err != nil || buf.String() != "/v1/hello/geektutu" {
+		t.Fatalf("unexpected template output %q, err %v", buf.String(), err)
+	}
+}
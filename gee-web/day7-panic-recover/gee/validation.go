@@ -0,0 +1,338 @@
+package gee
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// 根据 binding tag 校验绑定后的结构体，多个规则用逗号分隔
+// eg, Name string `json:"name" binding:"required,min=1,max=64"`
+// 内置规则: required, omitempty, min, max, len, email, oneof，
+// 也可以通过 Engine.RegisterValidator 注册自定义规则。
+// 嵌套的结构体、结构体指针和结构体切片会递归校验。
+// 每种类型的 tag 在第一次校验时解析并缓存，未知的规则、无法解析的参数、
+// 不支持 min/max/len 的字段类型都会在这时 panic，不会因请求数据不同而时有时无
+
+// 自定义校验函数，value 为字段的值，param 为 = 后面的参数
+type ValidatorFunc func(value interface{}, param string) bool
+
+// 单个字段的校验错误
+type FieldError struct {
+	Field   string `json:"field"` // 字段路径，优先使用 json tag，eg, address.city
+	Rule    string `json:"rule"`  // 未通过的规则
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Message
+}
+
+// 一次校验中所有字段的错误
+type ValidationErrors []FieldError
+
+func (ve ValidationErrors) Error() string {
+	messages := make([]string, len(ve))
+	for i, e := range ve {
+		messages[i] = e.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// 注册自定义校验规则，与内置规则同名时覆盖内置规则
+func (engine *Engine) RegisterValidator(name string, fn ValidatorFunc) {
+	if engine.validators == nil {
+		engine.validators = make(map[string]ValidatorFunc)
+	}
+	engine.validators[name] = fn
+	// 规则变化后重新解析 tag
+	engine.validationMu.Lock()
+	engine.validations = nil
+	engine.validationMu.Unlock()
+}
+
+// 解析后的单条规则
+type validationRule struct {
+	name   string
+	param  string
+	custom ValidatorFunc                              // 自定义规则
+	check  func(v reflect.Value, param string) string // 内置规则
+}
+
+// 解析后的字段，只包含导出的字段
+type fieldValidation struct {
+	index int
+	name  string
+	rules []validationRule
+}
+
+// 返回类型 t 解析后的字段，engine 为 nil 时不缓存
+func (engine *Engine) fieldValidations(t reflect.Type, validators map[string]ValidatorFunc) []fieldValidation {
+	if engine != nil {
+		engine.validationMu.RLock()
+		fields, ok := engine.validations[t]
+		engine.validationMu.RUnlock()
+		if ok {
+			return fields
+		}
+	}
+	fields := parseFieldValidations(t, validators)
+	if engine != nil {
+		engine.validationMu.Lock()
+		if engine.validations == nil {
+			engine.validations = make(map[reflect.Type][]fieldValidation)
+		}
+		engine.validations[t] = fields
+		engine.validationMu.Unlock()
+	}
+	return fields
+}
+
+func parseFieldValidations(t reflect.Type, validators map[string]ValidatorFunc) []fieldValidation {
+	var fields []fieldValidation
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		field := fieldValidation{index: i, name: fieldName(sf)}
+		if tag := sf.Tag.Get("binding"); tag != "" && tag != "-" {
+			field.rules = parseRules(t, sf, tag, validators)
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+var sizeRuleKinds = map[reflect.Kind]bool{
+	reflect.String: true, reflect.Slice: true, reflect.Map: true, reflect.Array: true,
+	reflect.Int: true, reflect.Int8: true, reflect.Int16: true, reflect.Int32: true, reflect.Int64: true,
+	reflect.Uint: true, reflect.Uint8: true, reflect.Uint16: true, reflect.Uint32: true, reflect.Uint64: true,
+	reflect.Float32: true, reflect.Float64: true,
+}
+
+func parseRules(t reflect.Type, sf reflect.StructField, tag string, validators map[string]ValidatorFunc) []validationRule {
+	var rules []validationRule
+	for _, rule := range strings.Split(tag, ",") {
+		rule = strings.TrimSpace(rule)
+		param := ""
+		if i := strings.IndexByte(rule, '='); i >= 0 {
+			rule, param = rule[:i], rule[i+1:]
+		}
+		switch rule {
+		case "":
+			continue
+		case "omitempty", "required":
+			rules = append(rules, validationRule{name: rule, param: param})
+			continue
+		}
+		if fn, ok := validators[rule]; ok {
+			rules = append(rules, validationRule{name: rule, param: param, custom: fn})
+			continue
+		}
+		check, ok := builtinRules[rule]
+		if !ok {
+			panic(fmt.Sprintf("unknown validation rule '%s' on field %s.%s", rule, t, sf.Name))
+		}
+		switch rule {
+		case "min", "max", "len":
+			if _, err := strconv.ParseFloat(param, 64); err != nil {
+				panic(fmt.Sprintf("invalid param '%s' of validation rule '%s' on field %s.%s", param, rule, t, sf.Name))
+			}
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if !sizeRuleKinds[ft.Kind()] {
+				panic(fmt.Sprintf("validation rule '%s' is not supported on field %s.%s of type %s", rule, t, sf.Name, sf.Type))
+			}
+		}
+		rules = append(rules, validationRule{name: rule, param: param, check: check})
+	}
+	return rules
+}
+
+// 校验 obj 的 binding tag，全部通过时返回 nil，否则返回 ValidationErrors
+func (engine *Engine) Validate(obj interface{}) error {
+	var validators map[string]ValidatorFunc
+	if engine != nil {
+		validators = engine.validators
+	}
+	v := reflect.ValueOf(obj)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	var errs ValidationErrors
+	engine.validateStruct(v, "", validators, &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (engine *Engine) validateStruct(v reflect.Value, prefix string, validators map[string]ValidatorFunc, errs *ValidationErrors) {
+	for _, fv := range engine.fieldValidations(v.Type(), validators) {
+		field := v.Field(fv.index)
+		name := prefix + fv.name
+		validateField(field, name, fv.rules, errs)
+		engine.validateNested(field, name, validators, errs)
+	}
+}
+
+// 递归校验嵌套的结构体
+func (engine *Engine) validateNested(field reflect.Value, name string, validators map[string]ValidatorFunc, errs *ValidationErrors) {
+	if field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			return
+		}
+		field = field.Elem()
+	}
+	switch field.Kind() {
+	case reflect.Struct:
+		if field.Type() != timeType {
+			engine.validateStruct(field, name+".", validators, errs)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < field.Len(); i++ {
+			engine.validateNested(field.Index(i), fmt.Sprintf("%s[%d]", name, i), validators, errs)
+		}
+	}
+}
+
+func fieldName(sf reflect.StructField) string {
+	if name := strings.Split(sf.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+		return name
+	}
+	return sf.Name
+}
+
+func validateField(field reflect.Value, name string, rules []validationRule, errs *ValidationErrors) {
+	for _, r := range rules {
+		rule, param := r.name, r.param
+		switch rule {
+		case "omitempty":
+			if isZero(field) {
+				return
+			}
+			continue
+		case "required":
+			if isZero(field) {
+				*errs = append(*errs, FieldError{name, rule, param, name + " is required"})
+				return
+			}
+			continue
+		}
+
+		// 其余规则作用于指针指向的值，nil 指针只检查 required
+		value := field
+		if value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				return
+			}
+			value = value.Elem()
+		}
+		if r.custom != nil {
+			if !r.custom(value.Interface(), param) {
+				*errs = append(*errs, FieldError{name, rule, param, fmt.Sprintf("%s failed on the '%s' rule", name, rule)})
+			}
+			continue
+		}
+		if message := r.check(value, param); message != "" {
+			*errs = append(*errs, FieldError{name, rule, param, name + " " + message})
+		}
+	}
+}
+
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.String, reflect.Array:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return v.IsZero()
+}
+
+// 内置规则，校验失败时返回错误描述
+var builtinRules = map[string]func(v reflect.Value, param string) string{
+	"min": func(v reflect.Value, param string) string {
+		if compareSize(v, param) < 0 {
+			return "must be at least " + param
+		}
+		return ""
+	},
+	"max": func(v reflect.Value, param string) string {
+		if compareSize(v, param) > 0 {
+			return "must be at most " + param
+		}
+		return ""
+	},
+	"len": func(v reflect.Value, param string) string {
+		if compareSize(v, param) != 0 {
+			return "must have length " + param
+		}
+		return ""
+	},
+	"email": func(v reflect.Value, param string) string {
+		if v.Kind() != reflect.String || !emailRegexp.MatchString(v.String()) {
+			return "must be a valid email address"
+		}
+		return ""
+	},
+	"oneof": func(v reflect.Value, param string) string {
+		s := fmt.Sprint(v.Interface())
+		for _, option := range strings.Fields(param) {
+			if s == option {
+				return ""
+			}
+		}
+		return fmt.Sprintf("must be one of [%s]", param)
+	},
+}
+
+var emailRegexp = regexp.MustCompile(`^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}$`)
+
+// 数字比较值，字符串比较字符数，切片、map 比较长度。
+// 参数和字段类型在解析 tag 时已经检查过
+func compareSize(v reflect.Value, param string) int {
+	limit, _ := strconv.ParseFloat(param, 64)
+	var size float64
+	switch v.Kind() {
+	case reflect.String:
+		size = float64(utf8.RuneCountInString(v.String()))
+	case reflect.Slice, reflect.Map, reflect.Array:
+		size = float64(v.Len())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size = float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		size = float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		size = v.Float()
+	}
+	switch {
+	case size < limit:
+		return -1
+	case size > limit:
+		return 1
+	}
+	return 0
+}
+
+// 以统一的格式返回 400，校验错误会列出所有字段
+// eg, {"message": "validation failed", "errors": [{"field": "name", "rule": "required", ...}]}
+func (c *Context) AbortWithBindError(err error) {
+	c.Errors = append(c.Errors, err)
+	if ve, ok := err.(ValidationErrors); ok {
+		c.AbortWithStatusJSON(http.StatusBadRequest, H{"message": "validation failed", "errors": ve})
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusBadRequest, H{"message": err.Error()})
+}
@@ -0,0 +1,117 @@
+package gee
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type signupItem struct {
+	SKU string `json:"sku" binding:"required,len=6"`
+}
+
+type signupForm struct {
+	Name  string       `json:"name" binding:"required,min=1,max=8"`
+	Email string       `json:"email" binding:"required,email"`
+	Role  string       `json:"role" binding:"omitempty,oneof=admin user"`
+	Age   *int         `json:"age" binding:"omitempty,min=18"`
+	Code  string       `json:"code" binding:"invite"`
+	Items []signupItem `json:"items" binding:"max=2"`
+}
+
+func TestValidate(t *testing.T) {
+	r := New()
+	r.RegisterValidator("invite", func(value interface{}, param string) bool {
+		return strings.HasPrefix(value.(string), "gee-")
+	})
+	r.POST("/signup", func(c *Context) {
+		var form signupForm
+		if c.BindJSON(&form) != nil {
+			return
+		}
+		c.String(http.StatusOK, form.Name)
+	})
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/signup", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post(`{"name":"geektutu","email":"gee@tutu.com","role":"admin","code":"gee-1","items":[{"sku":"abcdef"}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("valid form should pass, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = post(`{"name":"geektutu-jack","email":"gee","role":"root","age":16,"code":"x","items":[{"sku":"abc"}]}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid form should be 400, got %d", w.Code)
+	}
+	var resp struct {
+		Message string       `json:"message"`
+		Errors  []FieldError `json:"errors"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"name:max", "email:email", "role:oneof", "age:min", "code:invite", "items[0].sku:len"}
+	if len(resp.Errors) != len(want) {
+		t.Fatalf("got errors %+v, want %v", resp.Errors, want)
+	}
+	for i, e := range resp.Errors {
+		if e.Field+":"+e.Rule != want[i] {
+			t.Errorf("error %d: got %s:%s, want %s", i, e.Field, e.Rule, want[i])
+		}
+	}
+
+	w = post(`{}`)
+	if !strings.Contains(w.Body.String(), "name is required") {
+		t.Fatalf("missing required field should be reported, got %s", w.Body.String())
+	}
+}
+
+func TestValidateInvalidTags(t *testing.T) {
+	// 字段为空、omitempty 跳过了规则时同样 panic，不依赖请求数据
+	cases := map[string]interface{}{
+		"unknown rule": &struct {
+			Name string `binding:"omitempty,unknown"`
+		}{},
+		"invalid param": &struct {
+			Name string `binding:"omitempty,min=abc"`
+		}{},
+		"unsupported kind": &struct {
+			Done *bool `binding:"omitempty,max=1"`
+		}{},
+	}
+	r := New()
+	for name, obj := range cases {
+		func() {
+			defer func() {
+				if err := recover(); err == nil {
+					t.Errorf("%s: expected a panic", name)
+				}
+			}()
+			r.Validate(obj)
+		}()
+	}
+
+	// 解析结果按类型缓存，注册规则后重新解析
+	type invited struct {
+		Code string `binding:"invite"`
+	}
+	r.RegisterValidator("invite", func(value interface{}, param string) bool {
+		return value.(string) != ""
+	})
+	if err := r.Validate(&invited{}); err == nil {
+		t.Fatalf("custom rule should be checked")
+	}
+	r.RegisterValidator("invite", func(value interface{}, param string) bool {
+		return true
+	})
+	if err := r.Validate(&invited{}); err != nil {
+		t.Fatalf("re-registered rule should be used, got %v", err)
+	}
+}
@@ -0,0 +1,463 @@
+package gee
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// WebSocket (RFC 6455)，只使用标准库实现，不支持扩展(permessage-deflate 等)。
+// 握手在普通路由中完成，因此会经过分组中间件，例如鉴权:
+//
+//	ws := r.Group("/ws")
+//	ws.Use(auth)
+//	ws.GET("/chat", func(c *gee.Context) {
+//		conn, err := c.Upgrade()
+//		if err != nil {
+//			return // 已返回错误响应
+//		}
+//		defer conn.Close()
+//		for {
+//			mt, data, err := conn.ReadMessage()
+//			if err != nil {
+//				return
+//			}
+//			conn.WriteMessage(mt, data)
+//		}
+//	})
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const defaultMaxWebSocketMessageSize = 1 << 20 // 1 MB
+
+// 消息类型，与帧的 opcode 一致
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+
+	continuationFrame = 0
+)
+
+// 关闭码
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005 // 只用于表示对方没有发送关闭码，不能出现在关闭帧中
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseInternalServerErr       = 1011
+)
+
+// 控制帧的 payload 不能超过 125 字节
+const maxControlPayload = 125
+
+var ErrWebSocketClosed = errors.New("websocket: close frame has been sent")
+
+// 连接被关闭时 ReadMessage 返回的错误，Code 为对方发送的关闭码或因协议错误主动关闭的关闭码
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket: close %d %s", e.Code, e.Text)
+}
+
+type WebSocketConn struct {
+	conn        net.Conn
+	br          *bufio.Reader
+	Subprotocol string // 握手时选中的子协议
+
+	readLimit   int64
+	pongHandler func(data []byte)
+
+	writeMu   sync.Mutex
+	closeSent bool
+}
+
+// 完成 WebSocket 握手并接管连接，protocols 为服务端支持的子协议，按客户端的顺序选择第一个支持的。
+// 握手失败时已经返回错误响应并终止处理链，调用方只需直接返回
+func (c *Context) Upgrade(protocols ...string) (*WebSocketConn, error) {
+	if err := c.checkHandshake(); err != nil {
+		c.Errors = append(c.Errors, err)
+		code := http.StatusBadRequest
+		switch err {
+		case errBadWebSocketVersion:
+			// 告知客户端支持的版本
+			c.SetHeader("Sec-WebSocket-Version", "13")
+			code = http.StatusUpgradeRequired
+		case errBadWebSocketOrigin:
+			code = http.StatusForbidden
+		}
+		c.AbortWithStatusJSON(code, H{"message": err.Error()})
+		return nil, err
+	}
+	if c.Writer.Written() {
+		return nil, errors.New("websocket: response has already been written")
+	}
+
+	subprotocol := selectSubprotocol(c.Req.Header, protocols)
+	// 记录状态码供 Logger 使用，响应头由下面直接写入连接
+	c.Status(http.StatusSwitchingProtocols)
+	conn, brw, err := c.Writer.Hijack()
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return nil, err
+	}
+	// 清除 http.Server 设置的超时，之后由调用方通过 SetReadDeadline 等控制
+	conn.SetDeadline(time.Time{})
+
+	var buf strings.Builder
+	buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	buf.WriteString("Sec-WebSocket-Accept: " + acceptKey(c.Req.Header.Get("Sec-WebSocket-Key")) + "\r\n")
+	if subprotocol != "" {
+		buf.WriteString("Sec-WebSocket-Protocol: " + subprotocol + "\r\n")
+	}
+	// 中间件设置的响应头(如 Set-Cookie)一并发送
+	for key, values := range c.Writer.Header() {
+		switch key {
+		case "Upgrade", "Connection", "Sec-Websocket-Accept", "Sec-Websocket-Protocol":
+			continue
+		}
+		for _, value := range values {
+			buf.WriteString(key + ": " + sseReplacer.Replace(value) + "\r\n")
+		}
+	}
+	buf.WriteString("\r\n")
+	if _, err := brw.WriteString(buf.String()); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := brw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	readLimit := int64(defaultMaxWebSocketMessageSize)
+	if c.engine != nil && c.engine.MaxWebSocketMessageSize > 0 {
+		readLimit = c.engine.MaxWebSocketMessageSize
+	}
+	return &WebSocketConn{conn: conn, br: brw.Reader, Subprotocol: subprotocol, readLimit: readLimit}, nil
+}
+
+var (
+	errBadWebSocketVersion = errors.New("websocket: unsupported version, only 13 is supported")
+	errBadWebSocketOrigin  = errors.New("websocket: origin not allowed")
+)
+
+func (c *Context) checkHandshake() error {
+	req := c.Req
+	if req.Method != http.MethodGet {
+		return errors.New("websocket: handshake method must be GET")
+	}
+	if !headerContainsToken(req.Header, "Connection", "upgrade") || !headerContainsToken(req.Header, "Upgrade", "websocket") {
+		return errors.New("websocket: missing upgrade headers")
+	}
+	if req.Header.Get("Sec-WebSocket-Version") != "13" {
+		return errBadWebSocketVersion
+	}
+	key, err := base64.StdEncoding.DecodeString(req.Header.Get("Sec-WebSocket-Key"))
+	if err != nil || len(key) != 16 {
+		return errors.New("websocket: invalid Sec-WebSocket-Key")
+	}
+	checkOrigin := sameOrigin
+	if c.engine != nil && c.engine.CheckOrigin != nil {
+		checkOrigin = c.engine.CheckOrigin
+	}
+	if !checkOrigin(req) {
+		return errBadWebSocketOrigin
+	}
+	return nil
+}
+
+// 浏览器会带上 Origin，非浏览器客户端没有 Origin 时允许连接
+func sameOrigin(req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, req.Host)
+}
+
+// 逗号分隔的请求头中是否包含 token，忽略大小写
+func headerContainsToken(header http.Header, name string, token string) bool {
+	for _, value := range header[name] {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func selectSubprotocol(header http.Header, protocols []string) string {
+	for _, value := range header["Sec-Websocket-Protocol"] {
+		for _, requested := range strings.Split(value, ",") {
+			requested = strings.TrimSpace(requested)
+			for _, p := range protocols {
+				if requested == p {
+					return p
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func acceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// 单条消息(所有分片合计)的大小上限，超出时以 1009 关闭连接
+func (ws *WebSocketConn) SetReadLimit(limit int64) {
+	ws.readLimit = limit
+}
+
+// 收到 pong 时调用，通常用于延长读超时
+func (ws *WebSocketConn) SetPongHandler(h func(data []byte)) {
+	ws.pongHandler = h
+}
+
+func (ws *WebSocketConn) SetReadDeadline(t time.Time) error {
+	return ws.conn.SetReadDeadline(t)
+}
+
+func (ws *WebSocketConn) SetWriteDeadline(t time.Time) error {
+	return ws.conn.SetWriteDeadline(t)
+}
+
+func (ws *WebSocketConn) RemoteAddr() net.Addr {
+	return ws.conn.RemoteAddr()
+}
+
+// 读取一条完整的消息，分片会被合并，messageType 为 TextMessage 或 BinaryMessage。
+// ping 自动回复 pong；收到关闭帧或发生协议错误时回复关闭帧、关闭连接并返回 *CloseError
+func (ws *WebSocketConn) ReadMessage() (messageType int, data []byte, err error) {
+	for {
+		fin, opcode, payload, err := ws.readFrame(ws.readLimit - int64(len(data)))
+		if err != nil {
+			if ce, ok := err.(*CloseError); ok {
+				return 0, nil, ws.fail(ce.Code, ce.Text)
+			}
+			ws.conn.Close()
+			return 0, nil, err
+		}
+
+		switch opcode {
+		case PingMessage:
+			if err := ws.writeFrame(PongMessage, payload); err != nil && err != ErrWebSocketClosed {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			if ws.pongHandler != nil {
+				ws.pongHandler(payload)
+			}
+			continue
+		case CloseMessage:
+			return 0, nil, ws.handleClose(payload)
+		case TextMessage, BinaryMessage:
+			if messageType != 0 {
+				return 0, nil, ws.fail(CloseProtocolError, "expected continuation frame")
+			}
+			messageType = opcode
+		case continuationFrame:
+			if messageType == 0 {
+				return 0, nil, ws.fail(CloseProtocolError, "unexpected continuation frame")
+			}
+		default:
+			return 0, nil, ws.fail(CloseProtocolError, fmt.Sprintf("unknown opcode %d", opcode))
+		}
+
+		data = append(data, payload...)
+		if fin {
+			if messageType == TextMessage && !utf8.Valid(data) {
+				return 0, nil, ws.fail(CloseInvalidFramePayloadData, "invalid utf-8 in text message")
+			}
+			return messageType, data, nil
+		}
+	}
+}
+
+// 读取一帧，数据帧的 payload 不能超过 limit
+func (ws *WebSocketConn) readFrame(limit int64) (fin bool, opcode int, payload []byte, err error) {
+	var head [8]byte
+	if _, err = io.ReadFull(ws.br, head[:2]); err != nil {
+		return
+	}
+	fin = head[0]&0x80 != 0
+	opcode = int(head[0] & 0x0f)
+	masked := head[1]&0x80 != 0
+	length := int64(head[1] & 0x7f)
+
+	if head[0]&0x70 != 0 {
+		return false, 0, nil, &CloseError{CloseProtocolError, "reserved bits must be 0"}
+	}
+	switch length {
+	case 126:
+		if _, err = io.ReadFull(ws.br, head[:2]); err != nil {
+			return
+		}
+		length = int64(binary.BigEndian.Uint16(head[:2]))
+	case 127:
+		if _, err = io.ReadFull(ws.br, head[:8]); err != nil {
+			return
+		}
+		u := binary.BigEndian.Uint64(head[:8])
+		if u > 1<<63-1 {
+			return false, 0, nil, &CloseError{CloseProtocolError, "invalid payload length"}
+		}
+		length = int64(u)
+	}
+	// 客户端发送的帧必须经过掩码处理
+	if !masked {
+		return false, 0, nil, &CloseError{CloseProtocolError, "client frame must be masked"}
+	}
+	if opcode >= CloseMessage {
+		if !fin || length > maxControlPayload {
+			return false, 0, nil, &CloseError{CloseProtocolError, "invalid control frame"}
+		}
+	} else if length > limit {
+		return false, 0, nil, &CloseError{CloseMessageTooBig, "message too big"}
+	}
+
+	var mask [4]byte
+	if _, err = io.ReadFull(ws.br, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(ws.br, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return
+}
+
+// 回复对方的关闭帧并关闭连接
+func (ws *WebSocketConn) handleClose(payload []byte) error {
+	ce := &CloseError{Code: CloseNoStatusReceived}
+	switch {
+	case len(payload) == 1:
+		return ws.fail(CloseProtocolError, "invalid close payload")
+	case len(payload) >= 2:
+		ce.Code = int(binary.BigEndian.Uint16(payload))
+		ce.Text = string(payload[2:])
+		if !validCloseCode(ce.Code) {
+			return ws.fail(CloseProtocolError, "invalid close code")
+		}
+		if !utf8.ValidString(ce.Text) {
+			return ws.fail(CloseInvalidFramePayloadData, "invalid utf-8 in close reason")
+		}
+	}
+	if ce.Code == CloseNoStatusReceived {
+		ws.writeFrame(CloseMessage, nil)
+	} else {
+		ws.writeFrame(CloseMessage, closePayload(ce.Code, ""))
+	}
+	ws.conn.Close()
+	return ce
+}
+
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1011, code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+// 以 code 关闭连接，返回对应的 *CloseError
+func (ws *WebSocketConn) fail(code int, text string) error {
+	ws.writeFrame(CloseMessage, closePayload(code, text))
+	ws.conn.Close()
+	return &CloseError{Code: code, Text: text}
+}
+
+func closePayload(code int, text string) []byte {
+	if len(text) > maxControlPayload-2 {
+		text = text[:maxControlPayload-2]
+	}
+	payload := make([]byte, 2+len(text))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	copy(payload[2:], text)
+	return payload
+}
+
+// 发送一条消息，可以在多个 goroutine 中并发调用。
+// 控制消息(Ping、Pong、Close)的 data 不能超过 125 字节
+func (ws *WebSocketConn) WriteMessage(messageType int, data []byte) error {
+	switch messageType {
+	case TextMessage, BinaryMessage:
+	case CloseMessage, PingMessage, PongMessage:
+		if len(data) > maxControlPayload {
+			return errors.New("websocket: control message too big")
+		}
+	default:
+		return fmt.Errorf("websocket: unknown message type %d", messageType)
+	}
+	return ws.writeFrame(messageType, data)
+}
+
+// 服务端发送的帧不需要掩码，消息不分片
+func (ws *WebSocketConn) writeFrame(opcode int, payload []byte) error {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	if ws.closeSent {
+		return ErrWebSocketClosed
+	}
+	if opcode == CloseMessage {
+		ws.closeSent = true
+	}
+
+	frame := make([]byte, 0, 10+len(payload))
+	frame = append(frame, 0x80|byte(opcode))
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, byte(n))
+	case n <= 0xffff:
+		frame = append(frame, 126, byte(n>>8), byte(n))
+	default:
+		frame = append(frame, 127)
+		frame = append(frame, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(frame[2:], uint64(n))
+	}
+	frame = append(frame, payload...)
+	_, err := ws.conn.Write(frame)
+	return err
+}
+
+// 发送关闭帧后关闭连接
+func (ws *WebSocketConn) CloseWithCode(code int, text string) error {
+	err := ws.writeFrame(CloseMessage, closePayload(code, text))
+	if cerr := ws.conn.Close(); err == nil || err == ErrWebSocketClosed {
+		err = cerr
+	}
+	return err
+}
+
+func (ws *WebSocketConn) Close() error {
+	return ws.CloseWithCode(CloseNormalClosure, "")
+}
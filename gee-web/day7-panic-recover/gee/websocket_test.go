@@ -0,0 +1,211 @@
+package gee
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// 按 RFC 6455 发送带掩码的帧的最小客户端
+type wsTestClient struct {
+	conn net.Conn
+	br   *bufio.Reader
+	resp *http.Response
+}
+
+func dialWebSocket(t *testing.T, server *httptest.Server, path string, header http.Header) *wsTestClient {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &wsTestClient{conn: conn, br: br, resp: resp}
+}
+
+func (c *wsTestClient) writeFrame(fin bool, opcode int, payload []byte) {
+	b0 := byte(opcode)
+	if fin {
+		b0 |= 0x80
+	}
+	frame := []byte{b0}
+	if len(payload) <= 125 {
+		frame = append(frame, 0x80|byte(len(payload)))
+	} else {
+		frame = append(frame, 0x80|126, byte(len(payload)>>8), byte(len(payload)))
+	}
+	mask := []byte{1, 2, 3, 4}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	c.conn.Write(frame)
+}
+
+func (c *wsTestClient) readFrame(t *testing.T) (int, []byte) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		t.Fatal(err)
+	}
+	length := int(head[1] & 0x7f)
+	if length == 126 {
+		var ext [2]byte
+		io.ReadFull(c.br, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, length)
+	io.ReadFull(c.br, payload)
+	return int(head[0] & 0x0f), payload
+}
+
+func TestWebSocketEcho(t *testing.T) {
+	r := New()
+	ws := r.Group("/ws")
+	ws.Use(func(c *Context) {
+		if c.Query("token") != "secret" {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.SetHeader("X-User", "geektutu")
+		c.Next()
+	})
+	ws.GET("/echo", func(c *Context) {
+		conn, err := c.Upgrade("chat")
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			mt, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(mt, data)
+		}
+	})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	// 升级的路由同样经过分组中间件
+	client := dialWebSocket(t, server, "/ws/echo", nil)
+	if client.resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("middleware should reject the handshake, got %d", client.resp.StatusCode)
+	}
+	client.conn.Close()
+
+	client = dialWebSocket(t, server, "/ws/echo?token=secret", http.Header{"Sec-Websocket-Protocol": {"v2, chat"}})
+	defer client.conn.Close()
+	resp := client.resp
+	if resp.StatusCode != http.StatusSwitchingProtocols ||
+		resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" ||
+		resp.Header.Get("Sec-WebSocket-Protocol") != "chat" || resp.Header.Get("X-User") != "geektutu" {
+		t.Fatalf("unexpected handshake response %d %v", resp.StatusCode, resp.Header)
+	}
+
+	client.writeFrame(true, TextMessage, []byte("hello"))
+	if op, data := client.readFrame(t); op != TextMessage || string(data) != "hello" {
+		t.Fatalf("unexpected echo %d %q", op, data)
+	}
+
+	// 分片之间穿插 ping，服务端先回复 pong，再返回合并后的消息
+	client.writeFrame(false, BinaryMessage, []byte("gee-"))
+	client.writeFrame(true, PingMessage, []byte("p"))
+	client.writeFrame(true, continuationFrame, []byte(strings.Repeat("x", 200)))
+	if op, data := client.readFrame(t); op != PongMessage || string(data) != "p" {
+		t.Fatalf("ping should be answered with pong, got %d %q", op, data)
+	}
+	if op, data := client.readFrame(t); op != BinaryMessage || string(data) != "gee-"+strings.Repeat("x", 200) {
+		t.Fatalf("unexpected fragmented echo %d %q", op, data)
+	}
+
+	client.writeFrame(true, CloseMessage, closePayload(CloseGoingAway, "bye"))
+	op, data := client.readFrame(t)
+	if op != CloseMessage || binary.BigEndian.Uint16(data) != CloseGoingAway {
+		t.Fatalf("close should be echoed, got %d %v", op, data)
+	}
+}
+
+func TestWebSocketLimits(t *testing.T) {
+	r := New()
+	r.MaxWebSocketMessageSize = 16
+	errs := make(chan error, 1)
+	r.GET("/ws", func(c *Context) {
+		conn, err := c.Upgrade()
+		if err != nil {
+			return
+		}
+		_, _, err = conn.ReadMessage()
+		errs <- err
+	})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	client := dialWebSocket(t, server, "/ws", nil)
+	defer client.conn.Close()
+	client.writeFrame(false, TextMessage, []byte("0123456789"))
+	client.writeFrame(true, continuationFrame, []byte("0123456789"))
+	op, data := client.readFrame(t)
+	if op != CloseMessage || binary.BigEndian.Uint16(data) != CloseMessageTooBig {
+		t.Fatalf("oversized message should be closed with 1009, got %d %v", op, data)
+	}
+	if ce, ok := (<-errs).(*CloseError); !ok || ce.Code != CloseMessageTooBig {
+		t.Fatalf("unexpected error %v", ce)
+	}
+
+	// 未加掩码的帧是协议错误
+	client = dialWebSocket(t, server, "/ws", nil)
+	defer client.conn.Close()
+	client.conn.Write([]byte{0x81, 0x02, 'h', 'i'})
+	if op, data := client.readFrame(t); op != CloseMessage || binary.BigEndian.Uint16(data) != CloseProtocolError {
+		t.Fatalf("unmasked frame should be closed with 1002, got %d %v", op, data)
+	}
+	<-errs
+}
+
+func TestWebSocketBadHandshake(t *testing.T) {
+	r := New()
+	r.GET("/ws", func(c *Context) {
+		c.Upgrade()
+	})
+	if w := performRequest(r, http.MethodGet, "/ws"); w.Code != http.StatusBadRequest {
+		t.Fatalf("plain request should be rejected, got %d", w.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	req.Header.Set("Connection", "keep-alive, Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "8")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusUpgradeRequired || w.Header().Get("Sec-WebSocket-Version") != "13" {
+		t.Fatalf("unsupported version should be 426, got %d", w.Code)
+	}
+
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	req.Header.Set("Origin", "http://evil.com")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("cross origin handshake should be 403, got %d", w.Code)
+	}
+}
@@ -0,0 +1,235 @@
+package gee
+
+import (
+	"encoding"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 标准库没有 YAML，这里实现一个只用于输出响应的简单编码器:
+// map 按 key 排序，结构体字段名依次取 yaml tag、json tag、字段名，支持 omitempty，
+// 需要时字符串使用双引号转义，time.Time 输出为 RFC3339
+
+func marshalYAML(obj interface{}) ([]byte, error) {
+	var buf strings.Builder
+	v := indirect(reflect.ValueOf(obj))
+	if isYAMLScalar(v) {
+		s, err := yamlScalar(v)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString(s + "\n")
+		return []byte(buf.String()), nil
+	}
+	if isYAMLEmpty(v) {
+		return []byte(emptyYAML(v) + "\n"), nil
+	}
+	if err := writeYAMLBlock(&buf, v, 0); err != nil {
+		return nil, err
+	}
+	return []byte(buf.String()), nil
+}
+
+// 去掉指针和 interface，nil 保持无效值
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func isYAMLScalar(v reflect.Value) bool {
+	if !v.IsValid() || v.Type() == timeType {
+		return true
+	}
+	if _, ok := v.Interface().(encoding.TextMarshaler); ok {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.Map, reflect.Struct, reflect.Array:
+		return false
+	case reflect.Slice:
+		return v.Type().Elem().Kind() == reflect.Uint8 // []byte 作为字符串输出
+	}
+	return true
+}
+
+// 空集合在同一行输出为 {} 或 []，没有可输出字段的结构体同样是 {}
+func isYAMLEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array:
+		return v.Len() == 0
+	case reflect.Struct:
+		return len(yamlFields(v)) == 0
+	}
+	return false
+}
+
+func emptyYAML(v reflect.Value) string {
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		return "[]"
+	}
+	return "{}"
+}
+
+type yamlField struct {
+	key   string
+	value reflect.Value
+}
+
+// map 和结构体统一转换为有序的 key/value 列表
+func yamlFields(v reflect.Value) []yamlField {
+	var fields []yamlField
+	if v.Kind() == reflect.Map {
+		for _, k := range v.MapKeys() {
+			fields = append(fields, yamlField{fmt.Sprint(k.Interface()), v.MapIndex(k)})
+		}
+		sort.Slice(fields, func(i, j int) bool { return fields[i].key < fields[j].key })
+		return fields
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		tag := sf.Tag.Get("yaml")
+		if tag == "" {
+			tag = sf.Tag.Get("json")
+		}
+		opts := strings.Split(tag, ",")
+		if opts[0] == "-" {
+			continue
+		}
+		name := opts[0]
+		if name == "" {
+			name = sf.Name
+		}
+		field := v.Field(i)
+		if len(opts) > 1 && opts[1] == "omitempty" && isZero(field) {
+			continue
+		}
+		fields = append(fields, yamlField{name, field})
+	}
+	return fields
+}
+
+func writeYAMLBlock(buf *strings.Builder, v reflect.Value, indent int) error {
+	pad := strings.Repeat(" ", indent)
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		for i := 0; i < v.Len(); i++ {
+			item := indirect(v.Index(i))
+			buf.WriteString(pad + "-")
+			if err := writeYAMLItem(buf, item, indent); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, f := range yamlFields(v) {
+		buf.WriteString(pad + quoteYAML(f.key) + ":")
+		if err := writeYAMLValue(buf, indirect(f.value), indent+2); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 写入 "key:" 之后的部分，标量在同一行，集合另起一行缩进
+func writeYAMLValue(buf *strings.Builder, v reflect.Value, indent int) error {
+	if isYAMLScalar(v) {
+		s, err := yamlScalar(v)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(" " + s + "\n")
+		return nil
+	}
+	if isYAMLEmpty(v) {
+		buf.WriteString(" " + emptyYAML(v) + "\n")
+		return nil
+	}
+	buf.WriteString("\n")
+	return writeYAMLBlock(buf, v, indent)
+}
+
+// 写入 "-" 之后的部分，集合的第一行与 "-" 写在同一行
+func writeYAMLItem(buf *strings.Builder, v reflect.Value, indent int) error {
+	if isYAMLScalar(v) || isYAMLEmpty(v) {
+		return writeYAMLValue(buf, v, indent+2)
+	}
+	var item strings.Builder
+	if err := writeYAMLBlock(&item, v, indent+2); err != nil {
+		return err
+	}
+	buf.WriteString(" " + strings.TrimLeft(item.String(), " "))
+	return nil
+}
+
+func yamlScalar(v reflect.Value) (string, error) {
+	if !v.IsValid() {
+		return "null", nil
+	}
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).Format(time.RFC3339Nano), nil
+	}
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		text, err := m.MarshalText()
+		if err != nil {
+			return "", err
+		}
+		return quoteYAML(string(text)), nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return quoteYAML(v.String()), nil
+	case reflect.Slice:
+		return quoteYAML(string(v.Bytes())), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		// YAML 中的 NaN、Inf 写作 .nan、.inf
+		f := v.Float()
+		switch {
+		case math.IsNaN(f):
+			return ".nan", nil
+		case math.IsInf(f, 1):
+			return ".inf", nil
+		case math.IsInf(f, -1):
+			return "-.inf", nil
+		}
+		return strconv.FormatFloat(f, 'g', -1, v.Type().Bits()), nil
+	}
+	return "", fmt.Errorf("yaml: unsupported type %s", v.Type())
+}
+
+// 只有明确是普通字符串的值才不加引号: 以字母或 _ 开头，只包含字母、数字、空格和 _ . / @ -，
+// 并且不是 true、yes、y、null 等会被解析成其他类型的单词。
+// 时间、十六进制/八进制数字、.inf、.nan 等都以数字或符号开头，因此都会加引号
+var yamlPlainRegexp = regexp.MustCompile(`^[\p{L}_][\p{L}\p{N}_ ./@-]*$`)
+
+func quoteYAML(s string) string {
+	if !yamlPlainRegexp.MatchString(s) || strings.TrimSpace(s) != s {
+		return strconv.Quote(s)
+	}
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "on", "off", "y", "n", "null":
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -4,8 +4,10 @@ go 1.15
 
 require (
 	gee v0.0.0
+	geecache v0.0.0 // indirect
 )
 
 replace (
 	gee => ./gee
-)
\ No newline at end of file
+	geecache => ../../gee-cache/day7-proto-buf/geecache
+)